@@ -0,0 +1,19 @@
+package audit
+
+import "gorm.io/gorm"
+
+// Migrate makes audit_logs append-only. Run it after AutoMigrate.
+func Migrate(db *gorm.DB) error {
+	return db.Exec(`
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+CREATE TRIGGER audit_logs_append_only
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_logs
+	FOR EACH STATEMENT EXECUTE PROCEDURE audit_logs_append_only();
+`).Error
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+// Filter narrows db to the audit events matching the query, newest first.
+func Filter(db *gorm.DB, query *models.AuditQuery) *gorm.DB {
+	tx := db.Model(&models.AuditLog{})
+	if query.ActorID != "" {
+		tx = tx.Where("actor_id = ?", query.ActorID)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+	if query.Target != "" {
+		tx = tx.Where("target = ?", query.Target)
+	}
+	if query.RequestID != "" {
+		tx = tx.Where("request_id = ?", query.RequestID)
+	}
+	if query.IP != "" {
+		tx = tx.Where("ip = ?", query.IP)
+	}
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", query.To.AddDate(0, 0, 1))
+	}
+	return tx.Order("seq DESC")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const usage = `Build the bundled list of common and breached passwords.
+
+Usage:
+  go run breachlist/breachlist.go <output.gz> < passwords.txt
+
+Each input line is a plaintext password or a SHA-1 hash, optionally followed
+by ":<count>" as in the Have I Been Pwned downloads. The output holds the
+sorted, unique upper-case SHA-1 hashes, one per line, gzip compressed.
+Write it to utils/common-passwords.sha1.gz to replace the bundled list.`
+
+var sha1Line = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	hashes := map[string]bool{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if sha1Line.MatchString(line) {
+			hashes[strings.ToUpper(line[:40])] = true
+			continue
+		}
+
+		sum := sha1.Sum([]byte(line))
+		hashes[strings.ToUpper(hex.EncodeToString(sum[:]))] = true
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal("? Could not read input ", err)
+	}
+
+	sorted := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		sorted = append(sorted, hash)
+	}
+	sort.Strings(sorted)
+
+	file, err := os.Create(os.Args[1])
+	if err != nil {
+		log.Fatal("? Could not create output ", err)
+	}
+	defer file.Close()
+
+	writer, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
+	for _, hash := range sorted {
+		fmt.Fprintln(writer, hash)
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatal("? Could not write output ", err)
+	}
+
+	fmt.Printf("? Wrote %d hashes to %s\n", len(sorted), os.Args[1])
+}
@@ -0,0 +1,737 @@
+package controllers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/email"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
+	"gorm.io/gorm"
+)
+
+type AdminController struct {
+	DB *gorm.DB
+}
+
+func NewAdminController(DB *gorm.DB) AdminController {
+	return AdminController{DB}
+}
+
+// List roles with their permissions: /api/admin/roles - GET
+func (ac *AdminController) FindRoles(c *gin.Context) {
+	var roles []models.Role
+	result := ac.DB.Preload("Permissions").Order("name").Find(&roles)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(roles),
+		"data":    roles,
+	})
+}
+
+// Assign a role to a user: /api/admin/users/:userId/role - PUT
+func (ac *AdminController) AssignRole(c *gin.Context) {
+	userId := c.Param("userId")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.AssignRoleInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var role models.Role
+	if result := ac.DB.First(&role, "name = ?", payload.Role); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "No role with that name exists",
+		})
+		return
+	}
+
+	var user models.User
+	if result := ac.DB.First(&user, "id = ?", userId); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No user with that id exists",
+		})
+		return
+	}
+
+	// Prevents an admin from locking themselves out of the admin API.
+	if user.ID == currentUser.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You cannot change your own role",
+		})
+		return
+	}
+
+	previousRole := user.Role
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(models.User{Role: role.Name, UpdatedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditRoleChange, user.ID.String(), map[string]interface{}{
+			"from": previousRole,
+			"to":   role.Name,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"id":   user.ID,
+			"role": user.Role,
+		},
+	})
+}
+
+// Change role settings: /api/admin/roles/:roleName - PATCH
+func (ac *AdminController) UpdateRole(c *gin.Context) {
+	roleName := c.Param("roleName")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.UpdateRoleInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var role models.Role
+	if result := ac.DB.First(&role, "name = ?", roleName); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No role with that name exists",
+		})
+		return
+	}
+
+	previousRequireMFA := role.RequireMFA
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Updates(map[string]interface{}{"require_mfa": *payload.RequireMFA, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditRoleUpdate, role.Name, map[string]interface{}{
+			"require_mfa": map[string]bool{"from": previousRequireMFA, "to": *payload.RequireMFA},
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   role,
+	})
+}
+
+// List locked out accounts and IPs: /api/admin/lockouts - GET
+func (ac *AdminController) FindLockouts(c *gin.Context) {
+	var lockouts []models.LoginThrottle
+	result := ac.DB.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&lockouts)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(lockouts),
+		"data":    lockouts,
+	})
+}
+
+// Unlock an account or IP: /api/admin/lockouts/:lockoutId - DELETE
+func (ac *AdminController) LiftLockout(c *gin.Context) {
+	lockoutId := c.Param("lockoutId")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var lockout models.LoginThrottle
+	if result := ac.DB.First(&lockout, "id = ?", lockoutId); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No lockout with that id exists",
+		})
+		return
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&lockout).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditLockoutLift, lockout.Key, map[string]interface{}{
+			"failures": lockout.Failures,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func newAdminUserResponse(user models.User) models.AdminUserResponse {
+	return models.AdminUserResponse{
+		ID:                    user.ID,
+		Name:                  user.Name,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		Provider:              user.Provider,
+		Photo:                 user.Photo,
+		Verified:              user.Verified,
+		TOTPEnabled:           user.TOTPEnabled,
+		SuspendedAt:           user.SuspendedAt,
+		SuspendedReason:       user.SuspendedReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+	}
+}
+
+// searchUsers returns one page of the users matching the query, newest first,
+// and how many match in total.
+func (ac *AdminController) searchUsers(query *models.UserSearchQuery) ([]models.AdminUserResponse, int64, error) {
+	tx := ac.DB.Model(&models.User{})
+	if query.Email != "" {
+		tx = tx.Where("email ILIKE ?", "%"+strings.ToLower(query.Email)+"%")
+	}
+	if query.Provider != "" {
+		tx = tx.Where("provider = ?", query.Provider)
+	}
+	if query.Role != "" {
+		tx = tx.Where("role = ?", query.Role)
+	}
+	if query.Verified != nil {
+		tx = tx.Where("verified = ?", *query.Verified)
+	}
+	if query.Suspended != nil {
+		if *query.Suspended {
+			tx = tx.Where("suspended_at IS NOT NULL")
+		} else {
+			tx = tx.Where("suspended_at IS NULL")
+		}
+	}
+	if query.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", query.CreatedBefore.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	result := tx.Order("created_at DESC").Limit(query.Limit).Offset((query.Page - 1) * query.Limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	userResponses := make([]models.AdminUserResponse, 0, len(users))
+	for _, user := range users {
+		userResponses = append(userResponses, newAdminUserResponse(user))
+	}
+	return userResponses, total, nil
+}
+
+// findUser loads the :userId user, answering 404 when there is none.
+func (ac *AdminController) findUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if result := ac.DB.First(&user, "id = ?", c.Param("userId")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No user with that id exists",
+		})
+		return user, false
+	}
+	return user, true
+}
+
+// List users: /api/admin/users - GET
+// Filters: email, provider, role, verified, suspended, created_after,
+// created_before (YYYY-MM-DD), page and limit.
+func (ac *AdminController) FindUsers(c *gin.Context) {
+	var query models.UserSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	users, total, err := ac.searchUsers(&query)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(users),
+		"total":   total,
+		"data":    users,
+	})
+}
+
+// Show a user: /api/admin/users/:userId - GET
+func (ac *AdminController) FindUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   newAdminUserResponse(user),
+	})
+}
+
+// List a user's posts: /api/admin/users/:userId/posts - GET
+func (ac *AdminController) FindUserPosts(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var posts []models.Post
+	result := ac.DB.Where(&models.Post{User: user.ID}).Order("created_at DESC").Find(&posts)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(posts),
+		"data":    posts,
+	})
+}
+
+// List a user's generations: /api/admin/users/:userId/generations - GET
+func (ac *AdminController) FindUserGenerations(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var generations []models.Generation
+	result := ac.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&generations)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(generations),
+		"data":    generations,
+	})
+}
+
+// Show a user's generated image: /api/admin/users/:userId/generations/:generationId/image - GET
+func (ac *AdminController) FindUserGenerationImage(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var generation models.Generation
+	result := ac.DB.First(&generation, "id = ? AND user_id = ?", c.Param("generationId"), user.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No generation with that id exists",
+		})
+		return
+	}
+
+	serveGenerationImage(c, generation)
+}
+
+// List a user's active sessions: /api/admin/users/:userId/sessions - GET
+func (ac *AdminController) FindUserSessions(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := utils.FindActiveSessions(ac.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(sessions),
+		"data":    newSessionResponses(sessions, uuid.Nil),
+	})
+}
+
+// Suspend a user: /api/admin/users/:userId/suspend - POST
+// Every session is signed out and API keys stop working until unsuspended.
+func (ac *AdminController) SuspendUser(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.SuspendUserInput
+	if err := c.ShouldBind(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.ID == currentUser.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You cannot suspend yourself",
+		})
+		return
+	}
+
+	now := time.Now()
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":     now,
+			"suspended_reason": payload.Reason,
+			"updated_at":       now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := utils.RevokeUserRefreshTokens(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditUserSuspend, user.ID.String(), map[string]interface{}{
+			"reason": payload.Reason,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   newAdminUserResponse(user),
+	})
+}
+
+// Lift a suspension: /api/admin/users/:userId/suspend - DELETE
+func (ac *AdminController) UnsuspendUser(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.SuspendedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "The user is not suspended",
+		})
+		return
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":     nil,
+			"suspended_reason": "",
+			"updated_at":       time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditUserUnsuspend, user.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   newAdminUserResponse(user),
+	})
+}
+
+// Force a password reset: /api/admin/users/:userId/password-reset - POST
+// The user is signed out everywhere, cannot sign in with their current
+// password any more and is mailed a reset link.
+func (ac *AdminController) ForcePasswordReset(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "The user signs in with " + user.Provider + " and has no password",
+		})
+		return
+	}
+
+	var resetToken string
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if resetToken, err = utils.IssuePasswordResetToken(tx, &user); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("password_reset_required", true).Error; err != nil {
+			return err
+		}
+
+		if err := utils.RevokeUserRefreshTokens(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditPasswordResetForce, user.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	if err := email.SendPasswordReset(ac.DB, &user, config.ClientOrigin+"/api/auth/resetpassword/"+resetToken); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "There was an error sending the email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "The user has been signed out and sent a password reset link",
+	})
+}
+
+// Sign in as a user: /api/admin/users/:userId/impersonate - POST
+// The access token cookie is replaced by a short-lived one for the user; the
+// admin's refresh token is kept, so ending the impersonation at
+// /api/auth/impersonation - DELETE signs the admin back in.
+func (ac *AdminController) ImpersonateUser(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	// Impersonating another admin would let one admin act with another's powers
+	if user.ID == currentUser.ID || utils.HasPermission(ac.DB, user.Role, models.PermUsersImpersonate) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You cannot impersonate this user",
+		})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "The user is suspended",
+		})
+		return
+	}
+
+	// The impersonation lives only as long as the admin's own session
+	sessionID, ok := c.Get("sessionID")
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "Impersonation requires a signed-in session",
+		})
+		return
+	}
+
+	access_token, err := utils.CreateImpersonationToken(user, currentUser.ID, sessionID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := audit.Record(ac.DB, c, currentUser.ID, models.AuditImpersonationStart, user.ID.String(), nil); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.SetCookie("access_token", access_token, int(utils.ImpersonationTTL.Seconds()), "/", "localhost", false, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"access_token": access_token,
+		"data":         newAdminUserResponse(user),
+	})
+}
+
+// Show the user search page: /api/admin/console - GET
+func (ac *AdminController) ShowUsers(c *gin.Context) {
+	var query models.UserSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.HTML(http.StatusBadRequest, "admin_users.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+			"filters": c.Request.URL.Query(),
+		})
+		return
+	}
+
+	users, total, err := ac.searchUsers(&query)
+	if err != nil {
+		c.HTML(http.StatusBadGateway, "admin_users.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// The other filters are kept when paging
+	previous, next := c.Request.URL.Query(), c.Request.URL.Query()
+	previous.Set("page", strconv.Itoa(query.Page-1))
+	next.Set("page", strconv.Itoa(query.Page+1))
+
+	c.HTML(http.StatusOK, "admin_users.html", gin.H{
+		"filters":      c.Request.URL.Query(),
+		"users":        users,
+		"total":        total,
+		"previousPage": template.URL("?" + previous.Encode()),
+		"nextPage":     template.URL("?" + next.Encode()),
+		"hasPrevious":  query.Page > 1,
+		"hasNext":      int64(query.Page*query.Limit) < total,
+	})
+}
+
+// Show a user with their posts, generations and sessions: /api/admin/console/users/:userId - GET
+func (ac *AdminController) ShowUser(c *gin.Context) {
+	var user models.User
+	if result := ac.DB.First(&user, "id = ?", c.Param("userId")); result.Error != nil {
+		c.HTML(http.StatusNotFound, "admin_users.html", gin.H{
+			"status":  "fail",
+			"message": "No user with that id exists",
+		})
+		return
+	}
+
+	var posts []models.Post
+	var generations []models.Generation
+	var roles []models.Role
+	queries := []*gorm.DB{
+		ac.DB.Where(&models.Post{User: user.ID}).Order("created_at DESC").Find(&posts),
+		ac.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&generations),
+		ac.DB.Order("name").Find(&roles),
+	}
+	sessions, err := utils.FindActiveSessions(ac.DB, user.ID)
+	for _, query := range queries {
+		if query.Error != nil {
+			err = query.Error
+		}
+	}
+	if err != nil {
+		c.HTML(http.StatusBadGateway, "admin_users.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	generationURLs := make(map[uuid.UUID]string, len(generations))
+	for _, generation := range generations {
+		generationURLs[generation.ID] = fmt.Sprintf("/api/admin/users/%s/generations/%s/image", user.ID, generation.ID)
+	}
+
+	c.HTML(http.StatusOK, "admin_user.html", gin.H{
+		"user":           newAdminUserResponse(user),
+		"posts":          posts,
+		"generations":    generations,
+		"generationURLs": generationURLs,
+		"sessions":       newSessionResponses(sessions, uuid.Nil),
+		"roles":          roles,
+	})
+}
@@ -2,15 +2,23 @@ package controllers
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/email"
 	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/jobs"
 	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/storage"
 	"github.com/vuongtruongson99/ocr_project/utils"
 	"gorm.io/gorm"
 )
@@ -32,23 +40,34 @@ func (ac *AuthController) ShowSignUp(c *gin.Context) {
 	)
 }
 
-// Show SignIn form
-func (ac *AuthController) ShowSignIn(c *gin.Context) {
-	config, _ := initializers.LoadConfig(".")
+// signUpFailed shows the form again with the errors next to their fields.
+func signUpFailed(c *gin.Context, payload *models.SignUpInput, errs []utils.FieldError) {
+	values := gin.H{}
+	if payload != nil {
+		values = gin.H{"name": payload.Name, "email": payload.Email}
+	}
 
-	values := url.Values{}
-	values.Add("client_id", config.GoogleClientID)
-	values.Add("redirect_uri", config.GoogleOauthRedirectURL)
-	values.Add("response_type", "code")
-	values.Add("scope", "profile email")
+	errors := utils.FieldErrorsByName(errs)
+	message := "Please correct the errors below"
+	if formErrors, ok := errors[""]; ok {
+		message = formErrors[0]
+	}
 
-	url := "https://accounts.google.com/o/oauth2/auth?" + values.Encode()
+	c.HTML(http.StatusBadRequest, "signup.html", gin.H{
+		"status":  "fail",
+		"message": message,
+		"errors":  errors,
+		"values":  values,
+	})
+}
 
+// Show SignIn form
+func (ac *AuthController) ShowSignIn(c *gin.Context) {
 	c.HTML(
 		http.StatusOK,
 		"signin.html",
 		gin.H{
-			"url": url,
+			"returnTo": c.Query("return_to"),
 		},
 	)
 }
@@ -66,18 +85,18 @@ func (ac *AuthController) ShowMainTTI(c *gin.Context) {
 func (ac *AuthController) SignUpUser(c *gin.Context) {
 	var payload *models.SignUpInput
 
-	if err := c.Bind(&payload); err != nil {
-		c.HTML(http.StatusBadRequest, "signup.html", gin.H{
-			"status":  "fail",
-			"message": err.Error(),
-		})
+	if err := c.ShouldBind(&payload); err != nil {
+		signUpFailed(c, payload, utils.FieldErrors(err))
+		return
 	}
 
+	errs := utils.CurrentPasswordPolicy().Validate(payload.Password, payload.Name, payload.Email)
 	if payload.Password != payload.PasswordConfirm {
-		c.HTML(http.StatusBadRequest, "signup.html", gin.H{
-			"status":  "fail",
-			"message": "Passwords do not match",
-		})
+		errs = append(errs, utils.FieldError{Field: "passwordConfirm", Code: "mismatch", Message: "Passwords do not match"})
+	}
+	if len(errs) > 0 {
+		signUpFailed(c, payload, errs)
+		return
 	}
 
 	hashedPassword, err := utils.HashPassword(payload.Password)
@@ -86,21 +105,22 @@ func (ac *AuthController) SignUpUser(c *gin.Context) {
 			"status":  "error",
 			"message": err.Error(),
 		})
+		return
 	}
 
 	now := time.Now()
-	newUsers := models.User{
+	newUser := models.User{
 		Name:      payload.Name,
 		Email:     strings.ToLower(payload.Email),
 		Password:  hashedPassword,
-		Role:      "user",
-		Verified:  true,
+		Role:      models.RoleUser,
+		Verified:  false,
 		Provider:  "local",
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	result := ac.DB.Create(&newUsers)
+	result := ac.DB.Create(&newUser)
 
 	if result.Error != nil && strings.Contains(result.Error.Error(), "duplicate key value violates unique") {
 		c.HTML(http.StatusConflict, "signup.html", gin.H{
@@ -116,9 +136,317 @@ func (ac *AuthController) SignUpUser(c *gin.Context) {
 		return
 	}
 
+	if err := ac.sendVerificationEmail(&newUser); err != nil {
+		c.HTML(http.StatusBadGateway, "signup.html", gin.H{
+			"status":  "error",
+			"message": "Your account was created but we could not send the verification email, please request a new one",
+		})
+		return
+	}
+
 	c.HTML(http.StatusCreated, "signup.html", gin.H{
 		"status":  "success",
-		"message": "Successful created!"})
+		"message": "We sent an email with a verification link to " + newUser.Email})
+}
+
+// Generate a fresh single-use code, store its hash and mail the link to the user
+func (ac *AuthController) sendVerificationEmail(user *models.User) error {
+	config, _ := initializers.LoadConfig(".")
+
+	code := utils.GenerateCode()
+	result := ac.DB.Model(user).Updates(map[string]interface{}{
+		"verification_code":            utils.HashCode(code),
+		"verification_code_expires_at": time.Now().Add(utils.VerificationCodeTTL()),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return email.SendVerification(ac.DB, user, config.ClientOrigin+"/api/auth/verifyemail/"+code)
+}
+
+// Verify email: /api/auth/verifyemail/:code - GET
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	code := c.Param("code")
+
+	var user models.User
+	result := ac.DB.First(&user, "verification_code = ?", utils.HashCode(code))
+	if result.Error != nil || time.Now().After(user.VerificationCodeExpiresAt) {
+		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Invalid or expired verification link",
+		})
+		return
+	}
+
+	// Clearing the code makes the link single-use
+	result = ac.DB.Model(&models.User{}).
+		Where("id = ? AND verification_code = ?", user.ID, utils.HashCode(code)).
+		Updates(map[string]interface{}{
+			"verified":                     true,
+			"verification_code":            "",
+			"verification_code_expires_at": time.Time{},
+			"updated_at":                   time.Now(),
+		})
+	if result.Error != nil {
+		log.Printf("? Could not verify the email of %s: %v", user.ID, result.Error)
+		c.HTML(http.StatusInternalServerError, "signin.html", gin.H{
+			"status":  "error",
+			"message": "Could not verify your email, please try again",
+		})
+		return
+	}
+	if result.RowsAffected != 1 {
+		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Invalid or expired verification link",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "signin.html", gin.H{
+		"status":  "success",
+		"message": "Email verified successfully, you can now log in",
+	})
+}
+
+// Undo an account deletion: /api/auth/restore/:token - GET
+// The link is emailed on deletion and works until the account is purged. The
+// account's posts are listed again, but its API keys stay revoked: they may
+// have leaked while nobody was watching, so the user creates new ones.
+func (ac *AuthController) RestoreAccount(c *gin.Context) {
+	token := c.Param("token")
+
+	var user models.User
+	result := ac.DB.Unscoped().First(&user, "account_restore_token = ? AND deleted_at IS NOT NULL", utils.HashCode(token))
+	if result.Error != nil || time.Since(user.DeletedAt.Time) >= jobs.DeletionGracePeriod() {
+		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Invalid or expired restore link",
+		})
+		return
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		// Clearing the token makes the link single-use
+		result := tx.Unscoped().Model(&user).
+			Where("deleted_at IS NOT NULL").
+			Updates(map[string]interface{}{"deleted_at": nil, "account_restore_token": "", "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return audit.Record(tx, c, user.ID, models.AuditAccountRestore, user.ID.String(), nil)
+	})
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Invalid or expired restore link",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "signin.html", gin.H{
+		"status":  "success",
+		"message": "Your account has been restored, you can now log in. Your API keys were revoked when you deleted it, create new ones in your settings if you need them",
+	})
+}
+
+// Resend verification email: /api/auth/verifyemail/resend - POST
+func (ac *AuthController) ResendVerificationEmail(c *gin.Context) {
+	var payload *models.ResendVerificationInput
+
+	if err := c.Bind(&payload); err != nil {
+		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Same answer whether or not the account exists, so emails cannot be enumerated
+	message := "If an unverified account exists for that email, a new verification link has been sent"
+
+	var user models.User
+	result := ac.DB.First(&user, "email = ?", strings.ToLower(payload.Email))
+	if result.Error == nil && !user.Verified && user.Provider == "local" {
+		if err := ac.sendVerificationEmail(&user); err != nil {
+			c.HTML(http.StatusBadGateway, "signin.html", gin.H{
+				"status":  "fail",
+				"message": "There was an error sending the email",
+			})
+			return
+		}
+	}
+
+	c.HTML(http.StatusOK, "signin.html", gin.H{
+		"status":  "success",
+		"message": message,
+	})
+}
+
+// Show forgot password form
+func (ac *AuthController) ShowForgotPassword(c *gin.Context) {
+	c.HTML(http.StatusOK, "forgotpassword.html", gin.H{})
+}
+
+// Forgot password: /api/auth/forgotpassword - POST
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var payload *models.ForgotPasswordInput
+
+	if err := c.Bind(&payload); err != nil {
+		c.HTML(http.StatusBadRequest, "forgotpassword.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Same answer whether or not the account exists, so emails cannot be enumerated
+	message := "If an account exists for that email, you will receive a password reset link"
+
+	var user models.User
+	result := ac.DB.First(&user, "email = ?", strings.ToLower(payload.Email))
+	if result.Error != nil || user.Provider != "local" {
+		c.HTML(http.StatusOK, "forgotpassword.html", gin.H{
+			"status":  "success",
+			"message": message,
+		})
+		return
+	}
+
+	config, _ := initializers.LoadConfig(".")
+
+	resetToken, err := utils.IssuePasswordResetToken(ac.DB, &user)
+	if err != nil {
+		c.HTML(http.StatusBadGateway, "forgotpassword.html", gin.H{
+			"status":  "fail",
+			"message": "Something bad happened",
+		})
+		return
+	}
+
+	if err := email.SendPasswordReset(ac.DB, &user, config.ClientOrigin+"/api/auth/resetpassword/"+resetToken); err != nil {
+		c.HTML(http.StatusBadGateway, "forgotpassword.html", gin.H{
+			"status":  "fail",
+			"message": "There was an error sending the email",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "forgotpassword.html", gin.H{
+		"status":  "success",
+		"message": message,
+	})
+}
+
+// Show reset password form
+func (ac *AuthController) ShowResetPassword(c *gin.Context) {
+	c.HTML(http.StatusOK, "resetpassword.html", gin.H{
+		"token": c.Param("token"),
+	})
+}
+
+// Reset password: /api/auth/resetpassword/:token - PATCH
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	resetToken := c.Param("token")
+
+	var payload *models.ResetPasswordInput
+	if err := c.ShouldBind(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  utils.FieldErrors(err),
+		})
+		return
+	}
+
+	var user models.User
+	result := ac.DB.First(&user, "password_reset_token = ?", utils.HashCode(resetToken))
+	if result.Error != nil || time.Now().After(user.PasswordResetAt) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "The reset token is invalid or has expired",
+		})
+		return
+	}
+
+	errs := utils.CurrentPasswordPolicy().Validate(payload.Password, user.Name, user.Email)
+	if payload.Password != payload.PasswordConfirm {
+		errs = append(errs, utils.FieldError{Field: "passwordConfirm", Code: "mismatch", Message: "Passwords do not match"})
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  errs,
+		})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// The token is cleared only if it is still the one checked above, so a
+	// link used twice in parallel resets the password once
+	now := time.Now()
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND password_reset_token = ?", user.ID, utils.HashCode(resetToken)).
+			Updates(map[string]interface{}{
+				"password":                hashedPassword,
+				"password_reset_token":    "",
+				"password_reset_at":       time.Time{},
+				"password_reset_required": false,
+				"password_changed_at":     now,
+				"updated_at":              now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return utils.RevokeUserRefreshTokens(tx, user.ID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "The reset token is invalid or has expired",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("? Could not reset the password of %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Could not reset your password, please try again",
+		})
+		return
+	}
+
+	if err := email.SendSecurityAlert(ac.DB, &user, "password reset", c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("? Could not send the password reset alert to %s: %v", user.ID, err)
+	}
+
+	c.SetCookie("access_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("logged_in", "", -1, "/", "localhost", false, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password updated successfully, please log in again",
+	})
 }
 
 // Login User
@@ -133,11 +461,18 @@ func (ac *AuthController) SignInUser(c *gin.Context) {
 		return
 	}
 
+	accountKey := utils.AccountThrottleKey(payload.Email)
+	if wait := utils.LoginRetryAfter(ac.DB, accountKey, utils.IPThrottleKey(c.ClientIP())); wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
 	var user models.User
 	result := ac.DB.First(&user, "email = ?", strings.ToLower(payload.Email))
 
-	// Check email
-	if result.Error != nil {
+	// Check email and password
+	if result.Error != nil || utils.VerifyPassword(user.Password, payload.Password) != nil {
+		recordLoginFailure(ac.DB, c, payload.Email, &user, "password")
 		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
 			"status":  "fail",
 			"message": "Invalid email or password",
@@ -145,20 +480,115 @@ func (ac *AuthController) SignInUser(c *gin.Context) {
 		return
 	}
 
-	// Check password
-	if err := utils.VerifyPassword(user.Password, payload.Password); err != nil {
+	if user.PasswordResetRequired {
+		c.HTML(http.StatusForbidden, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "An administrator has required a password reset, please use the link we emailed you",
+		})
+		return
+	}
+
+	// Upgrade hashes made with an older algorithm or cost while we have the password
+	if utils.PasswordNeedsRehash(user.Password) {
+		if hashedPassword, err := utils.HashPassword(payload.Password); err == nil {
+			ac.DB.Model(&user).Update("password", hashedPassword)
+		}
+	}
+
+	// Check email verified
+	if user.Provider == "local" && !user.Verified {
+		c.HTML(http.StatusForbidden, "signin.html", gin.H{
+			"status":     "fail",
+			"message":    "Please verify your email address before logging in",
+			"unverified": true,
+			"email":      user.Email,
+		})
+		return
+	}
+
+	// Second step: the password alone does not start a session
+	if user.TOTPEnabled {
+		requireSecondFactor(c, user, "local")
+		return
+	}
+
+	utils.ResetLoginFailures(ac.DB, accountKey)
+
+	if err := ac.startSession(c, user, "local"); err != nil {
 		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
 			"status":  "fail",
-			"message": "Invalid email or password",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	config, _ := initializers.LoadConfig(".")
+	c.Redirect(http.StatusFound, "/api/auth/text-to-image")
+}
+
+// Second login step: /api/auth/login/mfa - POST
+func (ac *AuthController) SignInMFA(c *gin.Context) {
+	var payload *models.MFACodeInput
+
+	if err := c.Bind(&payload); err != nil {
+		c.HTML(http.StatusBadRequest, "mfa.html", gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
 
-	// Generate Token
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+	cookie, err := c.Cookie("mfa_token")
 	if err != nil {
+		c.HTML(http.StatusUnauthorized, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Your sign-in has expired, please log in again",
+		})
+		return
+	}
+
+	claims, err := utils.ValidateToken(cookie, utils.TokenTypeMFA, utils.AccessKeys)
+	if err != nil {
+		c.SetCookie("mfa_token", "", -1, "/api/auth", "localhost", false, true)
+		c.HTML(http.StatusUnauthorized, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Your sign-in has expired, please log in again",
+		})
+		return
+	}
+
+	var user models.User
+	result := ac.DB.First(&user, "id = ?", claims.Subject)
+	if result.Error != nil || !user.TOTPEnabled {
+		c.HTML(http.StatusUnauthorized, "signin.html", gin.H{
+			"status":  "fail",
+			"message": "Your sign-in has expired, please log in again",
+		})
+		return
+	}
+
+	accountKey := utils.AccountThrottleKey(user.Email)
+	if wait := utils.LoginRetryAfter(ac.DB, accountKey, utils.IPThrottleKey(c.ClientIP())); wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	if !utils.VerifySecondFactor(ac.DB, &user, payload.Code) {
+		recordLoginFailure(ac.DB, c, user.Email, &user, "second_factor")
+		c.HTML(http.StatusBadRequest, "mfa.html", gin.H{
+			"status":  "fail",
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	utils.ResetLoginFailures(ac.DB, accountKey)
+	c.SetCookie("mfa_token", "", -1, "/api/auth", "localhost", false, true)
+
+	provider := claims.Provider
+	if provider == "" {
+		provider = "local"
+	}
+	if err := ac.startSession(c, user, provider); err != nil {
 		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
 			"status":  "fail",
 			"message": err.Error(),
@@ -166,7 +596,17 @@ func (ac *AuthController) SignInUser(c *gin.Context) {
 		return
 	}
 
-	refresh_token, err := utils.CreateToken(config.RefreshTokenExpiresIn, user.ID, config.RefreshTokenPrivateKey)
+	c.Redirect(http.StatusFound, "/api/auth/text-to-image")
+}
+
+// requireSecondFactor ends the first sign-in step of a user with 2FA: it only
+// earns a short-lived "mfa pending" token, exchanged by SignInMFA.
+func requireSecondFactor(c *gin.Context, user models.User, provider string) {
+	mfa_token, err := utils.CreateToken(utils.MFATokenTTL, utils.Claims{
+		StandardClaims: jwt.StandardClaims{Subject: user.ID.String()},
+		Type:           utils.TokenTypeMFA,
+		Provider:       provider,
+	}, utils.AccessKeys)
 	if err != nil {
 		c.HTML(http.StatusBadRequest, "signin.html", gin.H{
 			"status":  "fail",
@@ -175,11 +615,74 @@ func (ac *AuthController) SignInUser(c *gin.Context) {
 		return
 	}
 
+	c.SetCookie("mfa_token", mfa_token, int(utils.MFATokenTTL.Seconds()), "/api/auth", "localhost", false, true)
+	c.HTML(http.StatusOK, "mfa.html", gin.H{})
+}
+
+// Audit a failed sign-in, count it against the account and the client IP, and
+// warn the owner when it locks the account.
+func recordLoginFailure(db *gorm.DB, c *gin.Context, address string, user *models.User, reason string) {
+	accountKey := utils.AccountThrottleKey(address)
+	var userID *uuid.UUID
+	if user.ID != uuid.Nil {
+		userID = &user.ID
+	}
+
+	if err := audit.Record(db, c, user.ID, models.AuditLoginFailure, strings.ToLower(address), map[string]interface{}{
+		"reason": reason,
+	}); err != nil {
+		log.Printf("? Could not audit the failed sign-in of %s: %v", address, err)
+	}
+
+	locked, err := utils.RecordLoginFailure(db, accountKey, models.ThrottleAccount, userID)
+	if err != nil {
+		log.Printf("? Could not count the failed sign-in of %s: %v", address, err)
+	}
+	if locked && userID != nil {
+		if err := email.SendSecurityAlert(db, user, "Account locked after too many failed sign-in attempts", c.ClientIP(), c.Request.UserAgent()); err != nil {
+			log.Printf("? Could not send the lockout alert to %s: %v", user.ID, err)
+		}
+	}
+
+	if _, err := utils.RecordLoginFailure(db, utils.IPThrottleKey(c.ClientIP()), models.ThrottleIP, nil); err != nil {
+		log.Printf("? Could not count the failed sign-in from %s: %v", c.ClientIP(), err)
+	}
+}
+
+func tooManyLoginAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	c.HTML(http.StatusTooManyRequests, "signin.html", gin.H{
+		"status":  "fail",
+		"message": "Too many failed sign-in attempts, please try again in " + wait.Round(time.Second).String(),
+	})
+}
+
+// Issue the access and refresh tokens of a new session as cookies
+func (ac *AuthController) startSession(c *gin.Context, user models.User, provider string) error {
+	config, _ := initializers.LoadConfig(".")
+
+	sessionID, refresh_token, err := utils.StartSession(ac.DB, c, user.ID, provider)
+	if err != nil {
+		return err
+	}
+
+	if err := audit.Record(ac.DB, c, user.ID, models.AuditLoginSuccess, sessionID.String(), map[string]interface{}{
+		"provider": provider,
+		"mfa":      user.TOTPEnabled,
+	}); err != nil {
+		log.Printf("? Could not audit the sign-in of %s: %v", user.ID, err)
+	}
+
+	access_token, err := utils.CreateAccessToken(user, sessionID)
+	if err != nil {
+		return err
+	}
+
 	c.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
 	c.SetCookie("refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
 	c.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, false)
 
-	c.Redirect(http.StatusFound, "/api/auth/text-to-image")
+	return nil
 }
 
 // Refresh access token
@@ -198,8 +701,16 @@ func (ac *AuthController) RefreshAccessToken(c *gin.Context) {
 
 	config, _ := initializers.LoadConfig(".")
 
-	sub, err := utils.ValidateToken(cookie, config.RefreshTokenPublicKey)
+	// Every refresh consumes the presented token and hands out its successor
+	record, refresh_token, err := utils.RotateRefreshToken(ac.DB, cookie)
+	if errors.Is(err, utils.ErrRefreshTokenReused) {
+		// The family was revoked; record who it belonged to
+		if err := audit.Record(ac.DB, c, record.UserID, models.AuditTokenReuse, record.FamilyID.String(), nil); err != nil {
+			log.Printf("? Could not audit the reuse of refresh token family %s: %v", record.FamilyID, err)
+		}
+	}
 	if err != nil {
+		c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 			"status":  "fail",
 			"message": err.Error(),
@@ -207,8 +718,10 @@ func (ac *AuthController) RefreshAccessToken(c *gin.Context) {
 		return
 	}
 
+	utils.TouchSession(ac.DB, c, record.FamilyID)
+
 	var user models.User
-	result := ac.DB.First(&user, "id = ?", fmt.Sprint(sub))
+	result := ac.DB.First(&user, "id = ?", record.UserID)
 
 	if result.Error != nil {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
@@ -217,23 +730,58 @@ func (ac *AuthController) RefreshAccessToken(c *gin.Context) {
 		return
 	}
 
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+	access_token, err := utils.CreateAccessToken(user, record.FamilyID)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": err.Error()})
 		return
 	}
 
+	if err := audit.Record(ac.DB, c, user.ID, models.AuditTokenRefresh, record.FamilyID.String(), nil); err != nil {
+		log.Printf("? Could not audit the token refresh of %s: %v", user.ID, err)
+	}
+
 	c.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
 	c.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, false)
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
 }
 
+// End impersonation: /api/auth/impersonation - DELETE
+// Drops the impersonation token and refreshes the admin's own session.
+func (ac *AuthController) StopImpersonation(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+	impersonatorID, ok := c.Get("impersonatorID")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "You are not impersonating anyone",
+		})
+		return
+	}
+
+	if err := audit.Record(ac.DB, c, impersonatorID.(uuid.UUID), models.AuditImpersonationStop, currentUser.ID.String(), nil); err != nil {
+		log.Printf("? Could not audit the end of impersonating %s: %v", currentUser.ID, err)
+	}
+
+	c.SetCookie("access_token", "", -1, "/", "localhost", false, true)
+	ac.RefreshAccessToken(c)
+}
+
+// Log out: /api/auth/logout - POST
+// The session is found from the refresh token cookie, so this works with an
+// expired or revoked access token too.
 func (ac *AuthController) LogoutUser(c *gin.Context) {
+	// Revoke server-side so a copied refresh token stops working too
+	if cookie, err := c.Cookie("refresh_token"); err == nil && cookie != "" {
+		if err := utils.RevokeRefreshToken(ac.DB, cookie); err != nil {
+			log.Printf("? Could not revoke the session on logout: %v", err)
+		}
+	}
+
 	c.SetCookie("access_token", "", -1, "/", "localhost", false, true)
 	c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
-	c.SetCookie("logged_id", "", -1, "/", "localhost", false, false)
-	// c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("logged_in", "", -1, "/", "localhost", false, false)
 
 	c.HTML(http.StatusOK, "home.html", gin.H{
 		"status": "success",
@@ -245,108 +793,68 @@ func (ac *AuthController) RequestImage(c *gin.Context) {
 	var payload *models.GenerateImage
 
 	if err := c.Bind(&payload); err != nil {
-		c.HTML(http.StatusBadRequest, "tti.html", gin.H{
+		respondTTI(c, http.StatusBadRequest, gin.H{
 			"status":  "fail",
 			"message": err.Error(),
 		})
+		return
 	}
 
 	config, _ := initializers.LoadConfig(".")
 	APIURL := "https://api-inference.huggingface.co/models/" + payload.Model
 
+	currentUser := c.MustGet("currentUser").(models.User)
+
 	var images []string
 	imageBytes, err := utils.Query(map[string]interface{}{
 		"inputs": payload.Prompt,
 	}, APIURL, config.HFAPIToken)
 
 	if err != nil {
-		fmt.Println("Error:", err)
-		return
-	}
-
-	img2 := base64.StdEncoding.EncodeToString(imageBytes)
-	images = append(images, img2)
-
-	// os.WriteFile("output/out.png", imageBytes, 0666)
-
-	c.HTML(http.StatusOK, "tti.html", gin.H{
-		"images": images,
-	})
-
-}
-
-// http://localhost:8080/api/sessions/oauth/google?
-// code=4%2F0AfJohXn-m5hdju_1ngwIGBuP2MtjBMHzWHpRDa-wtyN1CmWZqxflLx0FLBiTrBbzprY0PQ
-// scope=email+https%3A%2F%2Fwww.googleapis.com%2Fauth%2Fuserinfo.email+openid
-// authuser=0
-// prompt=consent
-
-func GoogleOauth(c *gin.Context) {
-	code := c.Query("code")
-
-	var pathUrl string = "/api/auth/text-to-image"
-
-	if c.Query("state") != "" {
-		pathUrl = c.Query("state")
-	}
-
-	if code == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "fail",
-			"message": "Authorization code not provided",
-		})
-		return
-	}
-
-	tokenRes, err := utils.GetGoogleOauthToken(code)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"status":  "fail",
+		log.Printf("? Could not generate an image with %s for %s: %v", payload.Model, currentUser.ID, err)
+		respondTTI(c, http.StatusBadGateway, gin.H{
+			"status":  "error",
 			"message": err.Error(),
 		})
 		return
 	}
 
-	google_user, err := utils.GetGoogleUser(tokenRes.Access_token, tokenRes.Id_token)
+	img2 := base64.StdEncoding.EncodeToString(imageBytes)
+	images = append(images, img2)
 
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"status":  "fail",
-			"message": err.Error(),
-		})
-		return
+	// Keep every generation so users can find and export it later
+	generation := models.Generation{
+		ID:        uuid.New(),
+		UserID:    currentUser.ID,
+		Model:     payload.Model,
+		Prompt:    payload.Prompt,
+		CreatedAt: time.Now(),
 	}
-	now := time.Now()
-	email := strings.ToLower(google_user.Email)
-
-	user_data := models.User{
-		Name:      google_user.Name,
-		Email:     email,
-		Password:  "",
-		Photo:     google_user.Picture,
-		Provider:  "Google",
-		Role:      "user",
-		Verified:  true,
-		CreatedAt: now,
-		UpdatedAt: now,
+	contentType, extension := utils.ImageType(imageBytes)
+	generation.ContentType = contentType
+	generation.ImageKey = fmt.Sprintf("generations/%s/%s%s", currentUser.ID, generation.ID, extension)
+	if err := storage.Default().Put(generation.ImageKey, imageBytes); err != nil {
+		log.Printf("? Could not store generation %s: %v", generation.ID, err)
+	} else if err := ac.DB.Create(&generation).Error; err != nil {
+		log.Printf("? Could not save generation %s: %v", generation.ID, err)
 	}
 
-	if initializers.DB.Model(&user_data).Where("email = ?", email).Updates(&user_data).RowsAffected == 0 {
-		initializers.DB.Create(&user_data)
+	if err := email.SendGenerationFinished(ac.DB, &currentUser, payload.Model, payload.Prompt, config.ClientOrigin+"/api/auth/text-to-image"); err != nil {
+		log.Printf("? Could not send the generation email to %s: %v", currentUser.ID, err)
 	}
 
-	var user models.User
-	initializers.DB.First(&user, "email = ?", email)
+	respondTTI(c, http.StatusOK, gin.H{
+		"status": "success",
+		"images": images,
+	})
 
-	config, _ := initializers.LoadConfig(".")
+}
 
-	token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+// respondTTI renders tti.html for browsers and JSON for API clients.
+func respondTTI(c *gin.Context, status int, obj gin.H) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		c.HTML(status, "tti.html", obj)
 		return
 	}
-
-	c.SetCookie("token", token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
-
-	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprint(config.ClientOrigin, pathUrl))
+	c.JSON(status, obj)
 }
@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/utils"
+)
+
+// Publish the access token verification keys: /.well-known/jwks.json - GET
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": utils.AccessKeys.PublicKeys(),
+	})
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/oidc"
+	"github.com/vuongtruongson99/ocr_project/utils"
+	"gorm.io/gorm"
+)
+
+const oauthCookiePath = "/api/sessions/oauth"
+
+// Start a provider login: /api/sessions/oauth/:provider/login - GET
+// Binds a signed, expiring state and the PKCE verifier to this browser before
+// redirecting to the provider.
+func OauthLogin(c *gin.Context) {
+	provider, ok := oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": "Unknown login provider"})
+		return
+	}
+
+	authURL, err := startOauthFlow(c, provider, c.Query("return_to"), "")
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// startOauthFlow stores the flow cookie and returns the provider consent URL.
+// linkUserID is set when the flow links an identity to a signed-in user.
+func startOauthFlow(c *gin.Context, provider *oidc.Provider, returnTo string, linkUserID string) (string, error) {
+	flow, state := utils.NewOauthFlow(provider.Config.Name, returnTo)
+	state.LinkUserID = linkUserID
+
+	signedState, err := utils.SignOauthValue(state)
+	if err != nil {
+		return "", err
+	}
+
+	signedFlow, err := utils.SignOauthValue(flow)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(signedState, flow.Nonce, flow.CodeChallenge())
+	if err != nil {
+		return "", err
+	}
+
+	c.SetCookie(utils.OauthFlowCookie, signedFlow, int(utils.OauthFlowTTL.Seconds()), oauthCookiePath, "localhost", false, true)
+	return authURL, nil
+}
+
+// Provider callback: /api/sessions/oauth/:provider - GET
+// e.g. http://localhost:8080/api/sessions/oauth/google?code=...&state=...
+func OauthCallback(c *gin.Context) {
+	provider, ok := oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": "Unknown login provider"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "fail",
+			"message": "Authorization code not provided",
+		})
+		return
+	}
+
+	flowCookie, err := c.Cookie(utils.OauthFlowCookie)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": utils.ErrInvalidOauthState.Error(),
+		})
+		return
+	}
+	c.SetCookie(utils.OauthFlowCookie, "", -1, oauthCookiePath, "localhost", false, true)
+
+	state, flow, err := utils.VerifyOauthCallback(provider.Config.Name, c.Query("state"), flowCookie)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tokenRes, err := provider.Exchange(code, flow.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	userInfo, err := provider.UserInfo(tokenRes, flow.Nonce)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if state.LinkUserID != "" {
+		linkIdentity(c, provider, state, userInfo)
+		return
+	}
+
+	user, err := findOrCreateOauthUser(c, provider, userInfo)
+	if errors.Is(err, errUnverifiedEmailConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	} else if errors.Is(err, errAccountPendingDeletion) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// The provider only vouches for the first factor
+	if user.TOTPEnabled {
+		requireSecondFactor(c, *user, provider.Config.Name)
+		return
+	}
+
+	config, _ := initializers.LoadConfig(".")
+
+	sessionID, refresh_token, err := utils.StartSession(initializers.DB, c, user.ID, provider.Config.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	if err := audit.Record(initializers.DB, c, user.ID, models.AuditLoginSuccess, sessionID.String(), map[string]interface{}{
+		"provider": provider.Config.Name,
+	}); err != nil {
+		log.Printf("? Could not audit the sign-in of %s: %v", user.ID, err)
+	}
+
+	token, err := utils.CreateAccessToken(*user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	c.SetCookie("access_token", token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	c.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+
+	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprint(config.ClientOrigin, state.ReturnTo))
+}
+
+var errUnverifiedEmailConflict = errors.New("An account with this email already exists. Sign in with your password and link this provider from your account settings")
+
+var errAccountPendingDeletion = errors.New("This account has been deleted. Restore it with the link in the email we sent you, then sign in again")
+
+// findOrCreateOauthUser resolves the user of a provider identity. A known
+// identity signs in its user. Otherwise an account with the same email is
+// only merged when the provider vouches for the email; never overwriting the
+// account's password, provider or role. New identities are audited like
+// explicit links. Accounts in their deletion grace period are refused until
+// they are restored.
+func findOrCreateOauthUser(c *gin.Context, provider *oidc.Provider, userInfo *oidc.UserInfo) (*models.User, error) {
+	now := time.Now()
+	var user models.User
+
+	var identity models.UserIdentity
+	result := initializers.DB.First(&identity, "provider = ? AND subject = ?", provider.Config.Name, userInfo.Subject)
+	if result.Error == nil {
+		if err := initializers.DB.Unscoped().First(&user, "id = ?", identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		if user.DeletedAt.Valid {
+			return nil, errAccountPendingDeletion
+		}
+		initializers.DB.Model(&identity).Updates(map[string]interface{}{"email": userInfo.Email, "last_login_at": now})
+		return &user, nil
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Deleted accounts still hold their email until they are purged
+		result := tx.Unscoped().First(&user, "email = ?", userInfo.Email)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		if result.Error == nil && user.DeletedAt.Valid {
+			return errAccountPendingDeletion
+		}
+
+		merged := result.Error == nil
+		if merged {
+			if !userInfo.EmailVerified {
+				return errUnverifiedEmailConflict
+			}
+
+			// Someone may have registered this email without proving it; the
+			// provider just did, so their password must not survive the merge.
+			if !user.Verified {
+				if err := tx.Model(&user).Updates(map[string]interface{}{"password": "", "verified": true, "updated_at": now}).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			user = models.User{
+				Name:      userInfo.Name,
+				Email:     userInfo.Email,
+				Password:  "",
+				Photo:     userInfo.Picture,
+				Provider:  provider.Config.DisplayName,
+				Role:      models.RoleUser,
+				Verified:  userInfo.EmailVerified,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		}
+
+		identity := models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider.Config.Name,
+			Subject:     userInfo.Subject,
+			Email:       userInfo.Email,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		}
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, user.ID, models.AuditIdentityLink, identity.ID.String(), map[string]interface{}{
+			"provider": provider.Config.Name,
+			"email":    userInfo.Email,
+			"merged":   merged,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// linkIdentity finishes a flow started by LinkIdentity.
+func linkIdentity(c *gin.Context, provider *oidc.Provider, state *utils.OauthState, userInfo *oidc.UserInfo) {
+	config, _ := initializers.LoadConfig(".")
+
+	var user models.User
+	if result := initializers.DB.First(&user, "id = ?", state.LinkUserID); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": "No user with that id exists"})
+		return
+	}
+
+	var existing models.UserIdentity
+	result := initializers.DB.First(&existing, "provider = ? AND subject = ?", provider.Config.Name, userInfo.Subject)
+	if result.Error == nil && existing.UserID != user.ID {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": "This " + provider.Config.DisplayName + " account is already linked to another user",
+		})
+		return
+	}
+
+	if result.Error != nil {
+		now := time.Now()
+		identity := models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider.Config.Name,
+			Subject:     userInfo.Subject,
+			Email:       userInfo.Email,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		}
+		err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+
+			return audit.Record(tx, c, user.ID, models.AuditIdentityLink, identity.ID.String(), map[string]interface{}{
+				"provider": provider.Config.Name,
+				"email":    userInfo.Email,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprint(config.ClientOrigin, state.ReturnTo))
+}
@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/jobs"
 	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
 	"gorm.io/gorm"
 )
 
@@ -39,9 +43,30 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 		UpdatedAt: now,
 	}
 
-	result := pc.DB.Create(&newPost)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key") {
+	status := payload.Status
+	if status == "" && payload.PublishAt != nil {
+		status = models.PostScheduled
+	} else if status == "" {
+		status = models.PostPublished
+	}
+	if err := newPost.SetStatus(status, payload.PublishAt, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newPost).Error; err != nil {
+			return err
+		}
+
+		_, err := utils.RecordPostRevision(tx, newPost, models.Post{}, currentUser.ID, nil)
+		return err
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
 			c.JSON(http.StatusConflict, gin.H{
 				"status":  "fail",
 				"message": "Post with that title already exists",
@@ -50,7 +75,7 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 		}
 		c.JSON(http.StatusBadGateway, gin.H{
 			"status":  "error",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
@@ -63,7 +88,6 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 
 // Update a post: /api/posts/:postID - PUT
 func (pc *PostController) UpdatePost(c *gin.Context) {
-	postId := c.Param("postId")
 	currentUser := c.MustGet("currentUser").(models.User)
 
 	var payload *models.UpdatePost
@@ -75,44 +99,286 @@ func (pc *PostController) UpdatePost(c *gin.Context) {
 		return
 	}
 
-	var updatePost models.Post
-	result := pc.DB.First(&updatePost, "id=?", postId)
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	updatePost, ok := pc.findVisiblePost(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CanUpdatePost(pc.DB, currentUser, updatePost) {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "fail",
-			"message": "No post with that title exists",
+			"message": "You are not allowed to update this post",
 		})
 		return
 	}
 
+	// The author is never reassigned: an admin editing a post keeps the original owner.
 	now := time.Now()
 	postToUpdate := models.Post{
 		Title:     payload.Title,
 		Content:   payload.Content,
 		Image:     payload.Image,
-		User:      currentUser.ID,
 		CreatedAt: updatePost.CreatedAt,
 		UpdatedAt: now,
 	}
 
-	pc.DB.Model(&updatePost).Updates(postToUpdate)
+	if err := pc.writePost(c, &updatePost, postToUpdate, nil); err != nil {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
 		"data":   updatePost,
 	})
 }
 
-// Get single post: /api/posts/:postID - GET
-func (pc *PostController) FindPostById(c *gin.Context) {
-	postId := c.Param("postId")
+// writePost applies the changes to the post and records the result as a new
+// revision and in the audit log, all in one transaction. Changes is a Post or,
+// to write zero values too, a map of columns.
+func (pc *PostController) writePost(c *gin.Context, post *models.Post, changes interface{}, restoredFrom *int) error {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	previous := *post
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(post).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		revision, err := utils.RecordPostRevision(tx, *post, previous, currentUser.ID, restoredFrom)
+		if err != nil {
+			return err
+		}
+
+		metadata := map[string]interface{}{"revision": revision.Number, "owner": post.User}
+		if restoredFrom != nil {
+			metadata["restored_from"] = *restoredFrom
+		}
+		if post.Status != previous.Status {
+			metadata["status"] = post.Status
+			metadata["previous_status"] = previous.Status
+		}
+		return audit.Record(tx, c, currentUser.ID, models.AuditPostUpdate, post.ID.String(), metadata)
+	})
+	if err != nil && strings.Contains(err.Error(), "duplicate key") {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": "Post with that title already exists",
+		})
+	} else if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	return err
+}
+
+// Change a post's status: /api/posts/:postId/status - PATCH
+func (pc *PostController) UpdatePostStatus(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.UpdatePostStatusInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	post, ok := pc.findVisiblePost(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CanUpdatePost(pc.DB, currentUser, post) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You are not allowed to update this post",
+		})
+		return
+	}
+
+	// SetStatus works on a copy, so the revision still sees the old post
+	now := time.Now()
+	updated := post
+	if err := updated.SetStatus(payload.Status, payload.PublishAt, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// A map, so that clearing publish_at is written too
+	changes := map[string]interface{}{
+		"status":       updated.Status,
+		"publish_at":   updated.PublishAt,
+		"published_at": updated.PublishedAt,
+		"updated_at":   now,
+	}
+	if err := pc.writePost(c, &post, changes, nil); err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   post,
+	})
+}
+
+// findVisiblePost loads the :postId post, answering 404 when it does not
+// exist or the current user may not see it yet.
+func (pc *PostController) findVisiblePost(c *gin.Context) (models.Post, bool) {
+	currentUser := c.MustGet("currentUser").(models.User)
 
 	var post models.Post
-	result := pc.DB.First(&post, "id = ?", postId)
+	result := pc.DB.Scopes(utils.LiveAuthors).First(&post, "id = ?", c.Param("postId"))
+	if result.Error != nil || !utils.CanViewPost(pc.DB, currentUser, post) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No post with that id exists",
+		})
+		return post, false
+	}
+	return post, true
+}
+
+// List a post's revisions: /api/posts/:postId/revisions - GET
+func (pc *PostController) FindRevisions(c *gin.Context) {
+	post, ok := pc.findVisiblePost(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.PostRevision
+	result := pc.DB.Where("post_id = ?", post.ID).Order("number DESC").Find(&revisions)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(revisions),
+		"data":    revisions,
+	})
+}
+
+// findRevision loads revision number of the :postId post, answering 404 when
+// the post or the revision does not exist, or the post is not visible.
+func (pc *PostController) findRevision(c *gin.Context, number string) (models.PostRevision, bool) {
+	var revision models.PostRevision
+	post, ok := pc.findVisiblePost(c)
+	if !ok {
+		return revision, false
+	}
+
+	result := pc.DB.First(&revision, "post_id = ? AND number = ?", post.ID, number)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "fail",
-			"message": "No post with that title exits",
+			"message": "No revision " + number + " of that post exists",
 		})
+		return revision, false
+	}
+	return revision, true
+}
+
+// Show one revision: /api/posts/:postId/revisions/:number - GET
+func (pc *PostController) FindRevision(c *gin.Context) {
+	revision, ok := pc.findRevision(c, c.Param("number"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   revision,
+	})
+}
+
+// Compare two revisions: /api/posts/:postId/revisions/diff?from=1&to=2 - GET
+func (pc *PostController) DiffRevisions(c *gin.Context) {
+	var query models.RevisionDiffQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  utils.FieldErrors(err),
+		})
+		return
+	}
+
+	from, ok := pc.findRevision(c, strconv.Itoa(query.From))
+	if !ok {
+		return
+	}
+	to, ok := pc.findRevision(c, strconv.Itoa(query.To))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": models.RevisionDiffResponse{
+			From:    from.Number,
+			To:      to.Number,
+			Changes: utils.DiffPostRevisions(from, to),
+		},
+	})
+}
+
+// Roll back to a revision: /api/posts/:postId/revisions/:number/rollback - POST
+// The post gets the revision's content as a new revision; history is kept.
+func (pc *PostController) RollbackRevision(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	revision, ok := pc.findRevision(c, c.Param("number"))
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if result := pc.DB.First(&post, "id = ?", revision.PostID); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No post with that id exists",
+		})
+		return
+	}
+
+	if !utils.CanUpdatePost(pc.DB, currentUser, post) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You are not allowed to update this post",
+		})
+		return
+	}
+
+	changes := models.Post{
+		Title:     revision.Title,
+		Content:   revision.Content,
+		Image:     revision.Image,
+		UpdatedAt: time.Now(),
+	}
+	if err := pc.writePost(c, &post, changes, &revision.Number); err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   post,
+	})
+}
+
+// Get single post: /api/posts/:postID - GET
+func (pc *PostController) FindPostById(c *gin.Context) {
+	post, ok := pc.findVisiblePost(c)
+	if !ok {
 		return
 	}
 
@@ -122,8 +388,10 @@ func (pc *PostController) FindPostById(c *gin.Context) {
 	})
 }
 
-// Get all posts: /api/posts/ - GET
+// Get all posts: /api/posts/?status=draft,scheduled - GET
+// Without a status filter every post the current user can see is listed.
 func (pc *PostController) FindPosts(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
 	var page = c.DefaultQuery("page", "1")
 	var limit = c.DefaultQuery("limit", "10")
 
@@ -131,13 +399,31 @@ func (pc *PostController) FindPosts(c *gin.Context) {
 	intLimit, _ := strconv.Atoi(limit)
 	offset := (intPage - 1) * intLimit
 
+	query := utils.VisiblePosts(pc.DB, pc.DB.Model(&models.Post{}), currentUser)
+	if status := c.Query("status"); status != "" {
+		statuses := strings.Split(status, ",")
+		for _, s := range statuses {
+			switch s {
+			case models.PostDraft, models.PostScheduled, models.PostPublished, models.PostArchived:
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  "fail",
+					"message": "Unknown post status " + s,
+				})
+				return
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+
 	var posts []models.Post
-	results := pc.DB.Limit(intLimit).Offset(offset).Find(&posts)
+	results := query.Limit(intLimit).Offset(offset).Find(&posts)
 	if results.Error != nil {
 		c.JSON(http.StatusBadGateway, gin.H{
 			"status":  "error",
-			"message": results.Error,
+			"message": results.Error.Error(),
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -147,19 +433,197 @@ func (pc *PostController) FindPosts(c *gin.Context) {
 	})
 }
 
-// Delete a posts: /api/posts/:postId - DELETE
+// Move a post to the trash: /api/posts/:postId - DELETE
 func (pc *PostController) DeletePost(c *gin.Context) {
-	postId := c.Param("postId")
+	currentUser := c.MustGet("currentUser").(models.User)
 
-	result := pc.DB.Delete(&models.Post{}, "id = ?", postId)
+	post, ok := pc.findVisiblePost(c)
+	if !ok {
+		return
+	}
 
-	if result.Error != nil {
+	if !utils.CanDeletePost(pc.DB, currentUser, post) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You are not allowed to delete this post",
+		})
+		return
+	}
+
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		// Someone else may have deleted it since it was loaded
+		result := tx.Delete(&post)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditPostDelete, post.ID.String(), map[string]interface{}{
+			"title": post.Title,
+			"owner": post.User,
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "fail",
 			"message": "No post with that title exists!",
 		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// List my deleted posts: /api/posts/trash - GET
+func (pc *PostController) FindTrash(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var posts []models.Post
+	result := pc.DB.Unscoped().
+		Where(&models.Post{User: currentUser.ID}).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&posts)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	retention := jobs.TrashRetention()
+	trashedPosts := make([]models.TrashedPostResponse, 0, len(posts))
+	for _, post := range posts {
+		trashedPosts = append(trashedPosts, models.TrashedPostResponse{Post: post, PurgeAt: post.DeletedAt.Time.Add(retention)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(trashedPosts),
+		"data":    trashedPosts,
+	})
+}
+
+// findTrashedPost loads the :postId post from the trash if the current user
+// may delete it, otherwise it answers 404 or 403.
+func (pc *PostController) findTrashedPost(c *gin.Context, currentUser models.User) (models.Post, bool) {
+	var post models.Post
+	result := pc.DB.Unscoped().First(&post, "id = ? AND deleted_at IS NOT NULL", c.Param("postId"))
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No post with that id is in the trash",
+		})
+		return post, false
+	}
+
+	if !utils.CanDeletePost(pc.DB, currentUser, post) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "You are not allowed to change this post",
+		})
+		return post, false
+	}
+
+	return post, true
+}
+
+// Restore a post from the trash: /api/posts/trash/:postId/restore - POST
+func (pc *PostController) RestorePost(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	post, ok := pc.findTrashedPost(c, currentUser)
+	if !ok {
+		return
+	}
+
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&post).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditPostRestore, post.ID.String(), map[string]interface{}{
+			"title": post.Title,
+			"owner": post.User,
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No post with that id is in the trash",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   post,
+	})
+}
+
+// Delete a post for good: /api/posts/trash/:postId - DELETE
+// Only posts already in the trash can be purged.
+func (pc *PostController) PurgePost(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	post, ok := pc.findTrashedPost(c, currentUser)
+	if !ok {
+		return
+	}
+
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&post)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostRevision{}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditPostPurge, post.ID.String(), map[string]interface{}{
+			"title": post.Title,
+			"owner": post.User,
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No post with that id is in the trash",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
@@ -1,10 +1,28 @@
 package controllers
 
 import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thanhpk/randstr"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/email"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/jobs"
 	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/oidc"
+	"github.com/vuongtruongson99/ocr_project/storage"
+	"github.com/vuongtruongson99/ocr_project/utils"
 	"gorm.io/gorm"
 )
 
@@ -19,19 +37,1038 @@ func NewUserController(DB *gorm.DB) UserController {
 func (uc *UserController) GetMe(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(models.User)
 
-	userResponse := &models.UserResponse{
-		ID:        currentUser.ID,
-		Name:      currentUser.Name,
-		Email:     currentUser.Email,
-		Photo:     currentUser.Photo,
-		Role:      currentUser.Role,
-		Provider:  currentUser.Provider,
-		CreatedAt: currentUser.CreatedAt,
-		UpdatedAt: currentUser.UpdatedAt,
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"user": newUserResponse(currentUser)}})
+}
+
+func newUserResponse(user models.User) *models.UserResponse {
+	return &models.UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Photo:     user.Photo,
+		Role:      user.Role,
+		Provider:  user.Provider,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+// Show the account settings page: /api/users/me/settings - GET
+func (uc *UserController) ShowSettings(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	c.HTML(http.StatusOK, "settings.html", gin.H{
+		"user":        newUserResponse(currentUser),
+		"hasPassword": currentUser.Password != "",
+	})
+}
+
+// Update my profile: /api/users/me - PATCH
+func (uc *UserController) UpdateMe(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.UpdateMeInput
+	if err := c.ShouldBind(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  utils.FieldErrors(err),
+		})
+		return
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if payload.Name != nil {
+		name := strings.TrimSpace(*payload.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "fail",
+				"message": "Please correct the errors below",
+				"errors":  []utils.FieldError{{Field: "name", Code: "required", Message: "This field is required"}},
+			})
+			return
+		}
+		updates["name"] = name
+	}
+	if payload.Photo != nil {
+		updates["photo"] = *payload.Photo
+	}
+
+	previousPhoto := currentUser.Photo
+	if result := uc.DB.Model(&currentUser).Updates(updates); result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	if payload.Photo != nil && previousPhoto != currentUser.Photo {
+		deleteStoredAvatar(currentUser.ID, previousPhoto)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
-		"data": gin.H{
-			"user": userResponse}})
+		"data":   gin.H{"user": newUserResponse(currentUser)},
+	})
+}
+
+// Change my password: /api/users/me/password - POST
+// Every other session is signed out.
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.ChangePasswordInput
+	if err := c.ShouldBind(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  utils.FieldErrors(err),
+		})
+		return
+	}
+
+	if !uc.reauthenticate(c, currentUser, payload.CurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "Your current password is incorrect",
+			"errors":  []utils.FieldError{{Field: "currentPassword", Code: "incorrect", Message: "Your current password is incorrect"}},
+		})
+		return
+	}
+
+	errs := utils.CurrentPasswordPolicy().Validate(payload.Password, currentUser.Name, currentUser.Email)
+	if payload.Password != payload.PasswordConfirm {
+		errs = append(errs, utils.FieldError{Field: "passwordConfirm", Code: "mismatch", Message: "Passwords do not match"})
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Please correct the errors below",
+			"errors":  errs,
+		})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	currentSessionID := utils.CurrentSessionID(uc.DB, c)
+	err = uc.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&currentUser).Updates(map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": now,
+			"updated_at":          now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := utils.RevokeOtherSessions(tx, currentUser.ID, currentSessionID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditPasswordChange, currentUser.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := email.SendSecurityAlert(uc.DB, &currentUser, "password changed", c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("? Could not send the password change alert to %s: %v", currentUser.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password updated successfully, your other sessions have been signed out",
+	})
+}
+
+// Upload my avatar: /api/users/me/avatar - POST (multipart, field "avatar")
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, utils.MaxAvatarBytes+1<<20)
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil || fileHeader.Size > utils.MaxAvatarBytes {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": fmt.Sprintf("Please upload an image of at most %d MB", utils.MaxAvatarBytes>>20),
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, utils.MaxAvatarBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	avatar, err := utils.ProcessAvatar(data)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// A new key per upload so browsers and proxies never serve a stale avatar
+	store := storage.Default()
+	key := fmt.Sprintf("avatars/%s-%s.png", currentUser.ID, randstr.Hex(8))
+	if err := store.Put(key, avatar); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	previousPhoto := currentUser.Photo
+	result := uc.DB.Model(&currentUser).Updates(map[string]interface{}{"photo": store.URL(key), "updated_at": time.Now()})
+	if result.Error != nil {
+		store.Delete(key)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	deleteStoredAvatar(currentUser.ID, previousPhoto)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   gin.H{"user": newUserResponse(currentUser)},
+	})
+}
+
+// deleteStoredAvatar removes an avatar we stored for the user; external photo
+// URLs, such as a provider's profile picture, are left alone.
+func deleteStoredAvatar(userID uuid.UUID, photo string) {
+	store := storage.Default()
+	if key, ok := store.Key(photo); ok && strings.HasPrefix(key, "avatars/"+userID.String()+"-") {
+		if err := store.Delete(key); err != nil {
+			log.Printf("? Could not delete %s: %v", key, err)
+		}
+	}
+}
+
+// List active sessions: /api/users/me/sessions - GET
+func (uc *UserController) FindMySessions(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	sessions, err := utils.FindActiveSessions(uc.DB, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	sessionResponses := newSessionResponses(sessions, utils.CurrentSessionID(uc.DB, c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(sessionResponses),
+		"data":    sessionResponses,
+	})
+}
+
+func newSessionResponses(sessions []models.Session, currentSessionID uuid.UUID) []models.SessionResponse {
+	sessionResponses := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, models.SessionResponse{
+			ID:         session.ID,
+			Provider:   session.Provider,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.ID == currentSessionID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+		})
+	}
+	return sessionResponses
+}
+
+// Sign out one session: /api/users/me/sessions/:sessionId - DELETE
+func (uc *UserController) DeleteMySession(c *gin.Context) {
+	sessionId := c.Param("sessionId")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var session models.Session
+	result := uc.DB.First(&session, "id = ? AND user_id = ? AND revoked_at IS NULL", sessionId, currentUser.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No session with that id exists",
+		})
+		return
+	}
+
+	if err := utils.RevokeRefreshTokenFamily(uc.DB, session.ID); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Log out everywhere: /api/users/me/sessions - DELETE
+func (uc *UserController) DeleteMySessions(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	if err := utils.RevokeUserRefreshTokens(uc.DB, currentUser.ID); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.SetCookie("access_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("logged_in", "", -1, "/", "localhost", false, false)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// reauthWindow is how recent a sign-in must be to stand in for a password.
+const reauthWindow = 10 * time.Minute
+
+// reauthenticate confirms a sensitive action: users with a password must type
+// it again, users without one must have signed in within reauthWindow.
+// Wrong passwords count towards the sign-in lockout, and while it is in effect
+// no password is checked and Retry-After is set on the response.
+func (uc *UserController) reauthenticate(c *gin.Context, user models.User, password string) bool {
+	if user.Password != "" {
+		accountKey := utils.AccountThrottleKey(user.Email)
+		if wait := utils.LoginRetryAfter(uc.DB, accountKey, utils.IPThrottleKey(c.ClientIP())); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			return false
+		}
+
+		if utils.VerifyPassword(user.Password, password) != nil {
+			recordLoginFailure(uc.DB, c, user.Email, &user, "reauthenticate")
+			return false
+		}
+
+		utils.ResetLoginFailures(uc.DB, accountKey)
+		return true
+	}
+
+	var session models.Session
+	result := uc.DB.First(&session, "id = ? AND revoked_at IS NULL", utils.CurrentSessionID(uc.DB, c))
+	return result.Error == nil && time.Since(session.CreatedAt) <= reauthWindow
+}
+
+// List linked identities: /api/users/me/identities - GET
+func (uc *UserController) FindMyIdentities(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var identities []models.UserIdentity
+	result := uc.DB.Where("user_id = ?", currentUser.ID).Order("created_at").Find(&identities)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	identityResponses := make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		identityResponses = append(identityResponses, models.IdentityResponse{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(identityResponses),
+		"data":    identityResponses,
+	})
+}
+
+// Start linking a provider: /api/users/me/identities/:provider - POST
+// Responds with the provider URL the browser must visit to finish linking.
+func (uc *UserController) LinkIdentity(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	provider, ok := oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": "Unknown login provider"})
+		return
+	}
+
+	var payload models.ReauthInput
+	c.ShouldBindJSON(&payload)
+
+	if !uc.reauthenticate(c, currentUser, payload.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "fail",
+			"message": "Please confirm your password or sign in again",
+		})
+		return
+	}
+
+	authURL, err := startOauthFlow(c, provider, c.Query("return_to"), currentUser.ID.String())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   gin.H{"url": authURL},
+	})
+}
+
+// Unlink a provider: /api/users/me/identities/:identityId - DELETE
+func (uc *UserController) UnlinkIdentity(c *gin.Context) {
+	identityId := c.Param("identityId")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var identity models.UserIdentity
+	result := uc.DB.First(&identity, "id = ? AND user_id = ?", identityId, currentUser.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No identity with that id exists",
+		})
+		return
+	}
+
+	var payload models.ReauthInput
+	c.ShouldBindJSON(&payload)
+
+	if !uc.reauthenticate(c, currentUser, payload.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "fail",
+			"message": "Please confirm your password or sign in again",
+		})
+		return
+	}
+
+	// Never leave an account without any way to sign in
+	var identityCount int64
+	uc.DB.Model(&models.UserIdentity{}).Where("user_id = ?", currentUser.ID).Count(&identityCount)
+	if currentUser.Password == "" && identityCount <= 1 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": "Set a password or link another provider before removing your last sign-in method",
+		})
+		return
+	}
+
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditIdentityUnlink, identity.ID.String(), map[string]interface{}{
+			"provider": identity.Provider,
+			"email":    identity.Email,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Start 2FA enrollment: /api/users/me/mfa/totp - POST
+// The secret only takes effect once a code from it is verified.
+func (uc *UserController) EnrollTOTP(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	if currentUser.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	key, qrCode, err := utils.GenerateTOTPKey(currentUser.Email)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := uc.DB.Model(&currentUser).Update("totp_secret", key.Secret()).Error; err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": models.TOTPEnrollmentResponse{
+			Secret:     key.Secret(),
+			OtpauthURL: key.URL(),
+			QRCode:     qrCode,
+		},
+	})
+}
+
+// Finish 2FA enrollment: /api/users/me/mfa/totp/verify - POST
+// Responds with the recovery codes, which are never shown again.
+func (uc *UserController) VerifyTOTP(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.MFACodeInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if currentUser.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "fail",
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	if !utils.ValidateTOTP(uc.DB, &currentUser, payload.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	var recoveryCodes []string
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&currentUser).Updates(map[string]interface{}{"totp_enabled": true, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if recoveryCodes, err = utils.ReplaceRecoveryCodes(tx, currentUser.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditMFAEnable, currentUser.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   gin.H{"recovery_codes": recoveryCodes},
+	})
+}
+
+// Disable 2FA: /api/users/me/mfa/totp - DELETE
+func (uc *UserController) DisableTOTP(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.MFACodeInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !currentUser.TOTPEnabled || !utils.VerifySecondFactor(uc.DB, &currentUser, payload.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&currentUser).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", currentUser.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditMFADisable, currentUser.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Replace recovery codes: /api/users/me/mfa/recovery-codes - POST
+func (uc *UserController) RegenerateRecoveryCodes(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.MFACodeInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !currentUser.TOTPEnabled || !utils.ValidateTOTP(uc.DB, &currentUser, payload.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	// The alert goes through the outbox, so it is sent only if the codes change
+	var recoveryCodes []string
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if recoveryCodes, err = utils.ReplaceRecoveryCodes(tx, currentUser.ID); err != nil {
+			return err
+		}
+
+		if err := audit.Record(tx, c, currentUser.ID, models.AuditMFARecoveryCodes, currentUser.ID.String(), nil); err != nil {
+			return err
+		}
+
+		return email.SendSecurityAlert(tx, &currentUser, "recovery codes replaced", c.ClientIP(), c.Request.UserAgent())
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   gin.H{"recovery_codes": recoveryCodes},
+	})
+}
+
+// List my API keys: /api/users/me/api-keys - GET
+func (uc *UserController) FindMyAPIKeys(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var apiKeys []models.APIKey
+	result := uc.DB.Where("user_id = ? AND revoked_at IS NULL", currentUser.ID).Order("created_at").Find(&apiKeys)
+	if result.Error != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	apiKeyResponses := make([]models.APIKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		apiKeyResponses = append(apiKeyResponses, newAPIKeyResponse(apiKey))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"results": len(apiKeyResponses),
+		"data":    apiKeyResponses,
+	})
+}
+
+// Create an API key: /api/users/me/api-keys - POST
+// The key itself is only returned in this response.
+func (uc *UserController) CreateAPIKey(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var payload *models.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	key, prefix := utils.GenerateAPIKey()
+	apiKey := models.APIKey{
+		UserID:    currentUser.ID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		KeyHash:   utils.HashCode(key),
+		Scopes:    strings.Join(payload.Scopes, " "),
+		CreatedAt: time.Now(),
+	}
+	if payload.ExpiresInDays > 0 {
+		expiresAt := apiKey.CreatedAt.AddDate(0, 0, payload.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditAPIKeyCreate, apiKey.ID.String(), map[string]interface{}{
+			"name":   apiKey.Name,
+			"scopes": apiKey.ScopeList(),
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	apiKeyResponse := newAPIKeyResponse(apiKey)
+	apiKeyResponse.Key = key
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"data":   apiKeyResponse,
+	})
+}
+
+// Revoke an API key: /api/users/me/api-keys/:keyId - DELETE
+func (uc *UserController) RevokeAPIKey(c *gin.Context) {
+	keyId := c.Param("keyId")
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var apiKey models.APIKey
+	result := uc.DB.First(&apiKey, "id = ? AND user_id = ? AND revoked_at IS NULL", keyId, currentUser.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No API key with that id exists",
+		})
+		return
+	}
+
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditAPIKeyRevoke, apiKey.ID.String(), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func newAPIKeyResponse(apiKey models.APIKey) models.APIKeyResponse {
+	return models.APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     utils.APIKeyPrefix + apiKey.Prefix,
+		Scopes:     apiKey.ScopeList(),
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+// Download my data: /api/users/me/export - GET
+// A ZIP of everything we hold about the user, with the generated images.
+func (uc *UserController) ExportMe(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var posts []models.Post
+	var generations []models.Generation
+	var sessions []models.Session
+	var identities []models.UserIdentity
+	var apiKeys []models.APIKey
+	var auditLogs []models.AuditLog
+	queries := []*gorm.DB{
+		uc.DB.Unscoped().Where(&models.Post{User: currentUser.ID}).Order("created_at").Find(&posts),
+		uc.DB.Where("user_id = ?", currentUser.ID).Order("created_at").Find(&generations),
+		uc.DB.Where("user_id = ?", currentUser.ID).Order("created_at").Find(&sessions),
+		uc.DB.Where("user_id = ?", currentUser.ID).Order("created_at").Find(&identities),
+		uc.DB.Where("user_id = ?", currentUser.ID).Order("created_at").Find(&apiKeys),
+		uc.DB.Where("actor_id = ? OR target = ?", currentUser.ID, currentUser.ID.String()).Order("created_at").Find(&auditLogs),
+	}
+	for _, query := range queries {
+		if query.Error != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"status":  "error",
+				"message": query.Error.Error(),
+			})
+			return
+		}
+	}
+
+	identityResponses := make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		identityResponses = append(identityResponses, models.IdentityResponse{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	// Events about the user by someone else, such as an admin, are theirs to
+	// see but where the other person acted from is not
+	for i := range auditLogs {
+		if auditLogs[i].ActorID != currentUser.ID {
+			auditLogs[i].IP = ""
+			auditLogs[i].UserAgent = ""
+		}
+	}
+
+	apiKeyResponses := make([]models.APIKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		apiKeyResponses = append(apiKeyResponses, newAPIKeyResponse(apiKey))
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", models.AccountExport{
+			ID:          currentUser.ID,
+			Name:        currentUser.Name,
+			Email:       currentUser.Email,
+			Role:        currentUser.Role,
+			Photo:       currentUser.Photo,
+			Provider:    currentUser.Provider,
+			Verified:    currentUser.Verified,
+			TOTPEnabled: currentUser.TOTPEnabled,
+			CreatedAt:   currentUser.CreatedAt,
+			UpdatedAt:   currentUser.UpdatedAt,
+		}},
+		{"posts.json", posts},
+		{"generations.json", generations},
+		{"sessions.json", newSessionResponses(sessions, uuid.Nil)},
+		{"identities.json", identityResponses},
+		{"api_keys.json", apiKeyResponses},
+		{"audit_events.json", auditLogs},
+	}
+
+	// Recorded before streaming: once the ZIP has started there is no way to
+	// report an error to the client.
+	if err := audit.Record(uc.DB, c, currentUser.ID, models.AuditAccountExport, currentUser.ID.String(), nil); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s-%s.zip"`, currentUser.ID, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			log.Printf("? Export of %s: could not add %s: %v", currentUser.ID, file.name, err)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			log.Printf("? Export of %s: could not add %s: %v", currentUser.ID, file.name, err)
+			return
+		}
+	}
+
+	store := storage.Default()
+	for _, generation := range generations {
+		data, err := store.Get(generation.ImageKey)
+		if err != nil {
+			log.Printf("? Export of %s: could not read %s: %v", currentUser.ID, generation.ImageKey, err)
+			continue
+		}
+
+		w, err := archive.Create(path.Join("generations", path.Base(generation.ImageKey)))
+		if err != nil {
+			log.Printf("? Export of %s: could not add %s: %v", currentUser.ID, generation.ImageKey, err)
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			log.Printf("? Export of %s: could not add %s: %v", currentUser.ID, generation.ImageKey, err)
+			return
+		}
+	}
+}
+
+// Show one of my generated images: /api/users/me/generations/:generationId/image - GET
+func (uc *UserController) FindMyGenerationImage(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	var generation models.Generation
+	result := uc.DB.First(&generation, "id = ? AND user_id = ?", c.Param("generationId"), currentUser.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "No generation with that id exists",
+		})
+		return
+	}
+
+	serveGenerationImage(c, generation)
+}
+
+// serveGenerationImage answers with the stored image. Generated images are
+// private, so callers must have checked the generation may be read.
+func serveGenerationImage(c *gin.Context, generation models.Generation) {
+	data, err := storage.Default().Get(generation.ImageKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "fail",
+			"message": "The image of this generation is gone",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, generation.ContentType, data)
+}
+
+// Delete my account: /api/users/me - DELETE
+// The account is disabled at once and purged with all its data after the
+// grace period. Until then its posts are hidden and the link in the
+// confirmation email restores it.
+func (uc *UserController) DeleteMe(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(models.User)
+
+	// Accounts without a password may send no body at all
+	var payload models.ReauthInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "fail",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if !uc.reauthenticate(c, currentUser, payload.Password) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "fail",
+			"message": "Please confirm with your password or sign in again",
+		})
+		return
+	}
+
+	config, _ := initializers.LoadConfig(".")
+
+	purgeAt := time.Now().Add(jobs.DeletionGracePeriod())
+	var restoreToken string
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := utils.RevokeUserRefreshTokens(tx, currentUser.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL", currentUser.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&currentUser).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if restoreToken, err = utils.IssueAccountRestoreToken(tx, &currentUser); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, currentUser.ID, models.AuditAccountDelete, currentUser.ID.String(), map[string]interface{}{
+			"purge_at": purgeAt,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	restoreURL := config.ClientOrigin + "/api/auth/restore/" + restoreToken
+	if err := email.SendAccountDeleted(uc.DB, &currentUser, restoreURL, purgeAt, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("? Could not send the account deletion email to %s: %v", currentUser.ID, err)
+	}
+
+	c.SetCookie("access_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("logged_in", "", -1, "/", "localhost", false, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Your account has been deleted",
+		"data":    gin.H{"purge_at": purgeAt},
+	})
 }
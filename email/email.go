@@ -0,0 +1,65 @@
+// Package email renders transactional emails from templates/email and
+// delivers them asynchronously through a Postgres outbox.
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/k3a/html2text"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const templateGlob = "templates/email/*.html"
+
+// Data is passed to every email template.
+type Data struct {
+	Name    string
+	Subject string
+	URL     string
+	// Extra holds template specific values, e.g. the prompt of a generation.
+	Extra map[string]string
+}
+
+// Render executes the named template and derives the plain-text alternative from it.
+func Render(templateName string, data *Data) (htmlBody string, textBody string, err error) {
+	tmpl, err := template.ParseGlob(templateGlob)
+	if err != nil {
+		return "", "", fmt.Errorf("could not parse email templates: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&body, templateName, data); err != nil {
+		return "", "", fmt.Errorf("could not render email %s: %w", templateName, err)
+	}
+
+	htmlBody = body.String()
+	textBody = html2text.HTML2TextWithOptions(htmlBody, html2text.WithLinksInnerText())
+
+	return htmlBody, textBody, nil
+}
+
+// Enqueue renders the email and stores it in the outbox; the worker delivers it.
+func Enqueue(db *gorm.DB, to string, templateName string, data *Data) error {
+	htmlBody, textBody, err := Render(templateName, data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	message := models.EmailOutbox{
+		To:            to,
+		Subject:       data.Subject,
+		HTMLBody:      htmlBody,
+		TextBody:      textBody,
+		Status:        models.EmailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return db.Create(&message).Error
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+func SendVerification(db *gorm.DB, user *models.User, url string) error {
+	return Enqueue(db, user.Email, "verificationCode.html", &Data{
+		Name:    user.Name,
+		Subject: "Your account verification link",
+		URL:     url,
+	})
+}
+
+func SendPasswordReset(db *gorm.DB, user *models.User, url string) error {
+	return Enqueue(db, user.Email, "resetPassword.html", &Data{
+		Name:    user.Name,
+		Subject: "Your password reset link",
+		URL:     url,
+	})
+}
+
+func SendGenerationFinished(db *gorm.DB, user *models.User, model string, prompt string, url string) error {
+	return Enqueue(db, user.Email, "generationFinished.html", &Data{
+		Name:    user.Name,
+		Subject: "Your image is ready",
+		URL:     url,
+		Extra: map[string]string{
+			"Model":  model,
+			"Prompt": prompt,
+		},
+	})
+}
+
+// SendSecurityAlert tells the user about a sensitive change on their account,
+// such as a password reset, with where it came from.
+func SendSecurityAlert(db *gorm.DB, user *models.User, event string, ip string, userAgent string) error {
+	return Enqueue(db, user.Email, "securityAlert.html", &Data{
+		Name:    user.Name,
+		Subject: "Security alert: " + event,
+		Extra: map[string]string{
+			"Event":     event,
+			"IP":        ip,
+			"UserAgent": userAgent,
+			"Time":      time.Now().UTC().Format(time.RFC1123),
+		},
+	})
+}
+
+// SendAccountDeleted confirms an account deletion with a link to undo it
+// before purgeAt.
+func SendAccountDeleted(db *gorm.DB, user *models.User, url string, purgeAt time.Time, ip string, userAgent string) error {
+	return Enqueue(db, user.Email, "accountDeleted.html", &Data{
+		Name:    user.Name,
+		Subject: "Your account has been deleted",
+		URL:     url,
+		Extra: map[string]string{
+			"PurgeAt":   purgeAt.UTC().Format(time.RFC1123),
+			"IP":        ip,
+			"UserAgent": userAgent,
+			"Time":      time.Now().UTC().Format(time.RFC1123),
+		},
+	})
+}
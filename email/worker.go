@@ -0,0 +1,132 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 10 * time.Second
+	batchSize    = 20
+	maxAttempts  = 6
+
+	sweepInterval = time.Hour
+	// outboxRetention is how long sent and failed rows are kept, bodies
+	// scrubbed, for troubleshooting delivery.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// StartWorker polls the outbox in the background, delivers due emails and
+// deletes finished ones once they are past outboxRetention.
+func StartWorker(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		sweeper := time.NewTicker(sweepInterval)
+		defer sweeper.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := deliverBatch(db); err != nil {
+					log.Println("? Email worker:", err)
+				}
+			case <-sweeper.C:
+				if err := sweepOutbox(db); err != nil {
+					log.Println("? Email outbox sweep:", err)
+				}
+			}
+		}
+	}()
+}
+
+// sweepOutbox deletes sent and failed messages older than outboxRetention,
+// and scrubs the bodies of any finished ones still holding theirs.
+func sweepOutbox(db *gorm.DB) error {
+	finished := []string{models.EmailSent, models.EmailFailed}
+
+	if err := db.Model(&models.EmailOutbox{}).
+		Where("status IN ? AND (html_body <> '' OR text_body <> '')", finished).
+		Updates(map[string]interface{}{"html_body": "", "text_body": ""}).Error; err != nil {
+		return err
+	}
+
+	return db.Where("status IN ? AND updated_at < ?", finished, time.Now().Add(-outboxRetention)).
+		Delete(&models.EmailOutbox{}).Error
+}
+
+// deliverBatch locks a batch of due messages so several app instances can run
+// the worker without sending the same email twice.
+func deliverBatch(db *gorm.DB) error {
+	config, err := initializers.LoadConfig(".")
+	if err != nil {
+		return fmt.Errorf("could not load config: %w", err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var messages []models.EmailOutbox
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.EmailPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(batchSize).
+			Find(&messages)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for i := range messages {
+			message := &messages[i]
+			now := time.Now()
+			message.Attempts++
+			message.UpdatedAt = now
+
+			if err := send(&config, message); err != nil {
+				message.LastError = err.Error()
+				if message.Attempts >= maxAttempts {
+					message.Status = models.EmailFailed
+				} else {
+					// Exponential backoff: 30s, 1m, 2m, 4m, ...
+					message.NextAttemptAt = now.Add(time.Duration(1<<(message.Attempts-1)) * 30 * time.Second)
+				}
+			} else {
+				message.Status = models.EmailSent
+				message.SentAt = &now
+				message.LastError = ""
+			}
+
+			// The bodies hold live links, which must not outlive delivery
+			if message.Status != models.EmailPending {
+				message.HTMLBody = ""
+				message.TextBody = ""
+			}
+
+			if err := tx.Save(message).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func send(config *initializers.Config, message *models.EmailOutbox) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", config.EmailFrom)
+	m.SetHeader("To", message.To)
+	m.SetHeader("Subject", message.Subject)
+	m.SetBody("text/plain", message.TextBody)
+	m.AddAlternative("text/html", message.HTMLBody)
+
+	d := gomail.NewDialer(config.SMTPHost, config.SMTPPort, config.SMTPUser, config.SMTPPass)
+	d.TLSConfig = &tls.Config{ServerName: config.SMTPHost}
+
+	return d.DialAndSend(m)
+}
@@ -1,6 +1,7 @@
 package initializers
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -25,11 +26,64 @@ type Config struct {
 	AccessTokenMaxAge      int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
 	RefreshTokenMaxAge     int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
 
+	// JWTIssuer defaults to ClientOrigin and JWTAudience to JWTIssuer.
+	JWTIssuer   string        `mapstructure:"JWT_ISSUER"`
+	JWTAudience string        `mapstructure:"JWT_AUDIENCE"`
+	JWTLeeway   time.Duration `mapstructure:"JWT_LEEWAY"`
+
 	HFAPIToken string `mapstructure:"API_TOKEN"`
 
 	GoogleClientID         string `mapstructure:"GOOGLE_OAUTH_CLIENT_ID"`
 	GoogleClientSecret     string `mapstructure:"GOOGLE_OAUTH_CLIENT_SECRET"`
 	GoogleOauthRedirectURL string `mapstructure:"GOOGLE_OAUTH_REDIRECT_URL"`
+
+	// Comma separated provider names, see oidc.LoadProviders.
+	OidcProviders string `mapstructure:"OIDC_PROVIDERS"`
+
+	OauthStateSecret string `mapstructure:"OAUTH_STATE_SECRET"`
+	// Comma separated local paths the OAuth callback may redirect to.
+	OauthAllowedReturnPaths string `mapstructure:"OAUTH_ALLOWED_RETURN_PATHS"`
+
+	EmailFrom string `mapstructure:"EMAIL_FROM"`
+	SMTPHost  string `mapstructure:"SMTP_HOST"`
+	SMTPPort  int    `mapstructure:"SMTP_PORT"`
+	SMTPUser  string `mapstructure:"SMTP_USER"`
+	SMTPPass  string `mapstructure:"SMTP_PASS"`
+
+	// PasswordHasher is "argon2id" (default) or "bcrypt". Zero values of the
+	// cost settings fall back to defaults, see utils/password.go.
+	PasswordHasher    string `mapstructure:"PASSWORD_HASHER"`
+	BcryptCost        int    `mapstructure:"PASSWORD_BCRYPT_COST"`
+	Argon2Memory      uint32 `mapstructure:"PASSWORD_ARGON2_MEMORY"` // KiB
+	Argon2Iterations  uint32 `mapstructure:"PASSWORD_ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `mapstructure:"PASSWORD_ARGON2_PARALLELISM"`
+
+	// Zero values fall back to 10, 128 and 3, see utils/password_policy.go.
+	PasswordMinLength        int `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength        int `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordCharacterClasses int `mapstructure:"PASSWORD_CHARACTER_CLASSES"`
+
+	// StorageDir holds uploaded files, "uploads" when empty.
+	StorageDir string `mapstructure:"STORAGE_DIR"`
+
+	// AuditHashChain links every audit event to the one before it by hash,
+	// see package audit.
+	AuditHashChain bool `mapstructure:"AUDIT_HASH_CHAIN"`
+
+	// AccountDeletionGracePeriod is how long a deleted account is kept before
+	// it is purged, 720h (30 days) when empty.
+	AccountDeletionGracePeriod time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+
+	// PostTrashRetentionDays is how long deleted posts stay in the trash, 30
+	// when empty.
+	PostTrashRetentionDays int `mapstructure:"POST_TRASH_RETENTION_DAYS"`
+
+	// VerificationCodeExpiresIn is how long an email verification link is
+	// valid, 24h when empty.
+	VerificationCodeExpiresIn time.Duration `mapstructure:"VERIFICATION_CODE_EXPIRED_IN"`
+	// PasswordResetExpiresIn is how long a password reset link is valid, 1h
+	// when empty.
+	PasswordResetExpiresIn time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_EXPIRED_IN"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -46,3 +100,9 @@ func LoadConfig(path string) (config Config, err error) {
 	err = viper.Unmarshal(&config)
 	return
 }
+
+// OidcProviderSetting reads OIDC_<NAME>_<KEY>. Provider settings are dynamic so
+// they cannot be fields of Config; LoadConfig must have been called first.
+func OidcProviderSetting(name string, key string) string {
+	return viper.GetString("OIDC_" + strings.ToUpper(name) + "_" + key)
+}
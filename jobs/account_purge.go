@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	purgeInterval              = time.Hour
+	purgeBatchSize             = 50
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+)
+
+// DeletionGracePeriod is how long a deleted account is kept before it is purged.
+func DeletionGracePeriod() time.Duration {
+	config, _ := initializers.LoadConfig(".")
+	if config.AccountDeletionGracePeriod == 0 {
+		return defaultDeletionGracePeriod
+	}
+	return config.AccountDeletionGracePeriod
+}
+
+// StartAccountPurger purges accounts whose deletion grace period has passed.
+func StartAccountPurger(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := purgeDeletedAccounts(db); err != nil {
+				log.Println("? Account purger:", err)
+			}
+		}
+	}()
+}
+
+func purgeDeletedAccounts(db *gorm.DB) error {
+	var users []models.User
+	result := db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-DeletionGracePeriod())).
+		Limit(purgeBatchSize).
+		Find(&users)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, user := range users {
+		if err := PurgeAccount(db, user); err != nil {
+			log.Printf("? Could not purge account %s: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+// PurgeAccount deletes the user with everything they own, then their stored
+// files. Audit entries are kept as the security record of the account.
+func PurgeAccount(db *gorm.DB, user models.User) error {
+	var generations []models.Generation
+	if err := db.Where("user_id = ?", user.ID).Find(&generations).Error; err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		owned := []interface{}{
+			&models.Generation{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{},
+			&models.RecoveryCode{}, &models.APIKey{}, &models.LoginThrottle{},
+		}
+		for _, model := range owned {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Struct conditions quote the "user" and "to" columns
+		posts := tx.Unscoped().Model(&models.Post{}).Select("id").Where(&models.Post{User: user.ID})
+		if err := tx.Where("post_id IN (?)", posts).Delete(&models.PostRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where(&models.Post{User: user.ID}).Delete(&models.Post{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(&models.EmailOutbox{To: user.Email}).Delete(&models.EmailOutbox{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files go last: a failed transaction must not leave rows pointing at
+	// deleted files, while a leftover file is only wasted space.
+	store := storage.Default()
+	for _, generation := range generations {
+		if err := store.Delete(generation.ImageKey); err != nil {
+			log.Printf("? Could not delete %s: %v", generation.ImageKey, err)
+		}
+	}
+	if key, ok := store.Key(user.Photo); ok {
+		if err := store.Delete(key); err != nil {
+			log.Printf("? Could not delete %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
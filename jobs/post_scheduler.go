@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const publishInterval = time.Minute
+
+// StartPostScheduler publishes scheduled posts once their publish_at is due.
+func StartPostScheduler(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(publishInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := PublishDuePosts(db, time.Now()); err != nil {
+				log.Println("? Post scheduler:", err)
+			}
+		}
+	}()
+}
+
+// PublishDuePosts publishes the scheduled posts due at now. The publish time
+// recorded is the scheduled one, not when the scheduler got to it.
+func PublishDuePosts(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Model(&models.Post{}).
+		Where("status = ? AND publish_at <= ?", models.PostScheduled, now).
+		Updates(map[string]interface{}{
+			"status":       models.PostPublished,
+			"published_at": gorm.Expr("publish_at"),
+			"publish_at":   nil,
+		})
+	return result.RowsAffected, result.Error
+}
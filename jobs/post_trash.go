@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/audit"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const defaultTrashRetentionDays = 30
+
+// TrashRetention is how long a deleted post stays in the trash.
+func TrashRetention() time.Duration {
+	config, _ := initializers.LoadConfig(".")
+	days := config.PostTrashRetentionDays
+	if days <= 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartTrashPurger permanently deletes posts that have been in the trash for
+// longer than the retention period.
+func StartTrashPurger(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := purgeTrash(db); err != nil {
+				log.Println("? Trash purger:", err)
+			}
+		}
+	}()
+}
+
+func purgeTrash(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Post{}).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-TrashRetention()))
+
+		if err := tx.Where("post_id IN (?)", expired).Delete(&models.PostRevision{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("id IN (?)", expired).Delete(&models.Post{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return audit.Record(tx, nil, uuid.Nil, models.AuditPostPurge, "", map[string]interface{}{
+			"posts":  result.RowsAffected,
+			"reason": "retention",
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
+)
+
+const usage = `Manage the JWT signing keys.
+
+Usage:
+  go run keys/keys.go list
+  go run keys/keys.go generate <access|refresh>   add a pending key, published in the JWKS but not used yet
+  go run keys/keys.go rotate <access|refresh>     activate the newest pending key (or a new one) and retire the active key
+  go run keys/keys.go prune <access|refresh>      delete keys retired for longer than the token lifetime
+
+Generate, wait for verifiers to refresh the JWKS (at least 5 minutes), then
+rotate. Retired keys keep validating their tokens, so nobody is logged out.`
+
+var config initializers.Config
+
+func init() {
+	var err error
+	config, err = initializers.LoadConfig(".")
+	if err != nil {
+		log.Fatal("? Could not load environment variables", err)
+	}
+
+	initializers.ConnectDB(&config)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	if os.Args[1] == "list" {
+		list()
+		return
+	}
+
+	if len(os.Args) != 3 || (os.Args[2] != models.KeyUseAccess && os.Args[2] != models.KeyUseRefresh) {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	use := os.Args[2]
+
+	switch os.Args[1] {
+	case "generate":
+		key, err := utils.GenerateSigningKey(initializers.DB, use)
+		if err != nil {
+			log.Fatal("? Could not generate key ", err)
+		}
+		fmt.Printf("? Generated pending %s key %s\n", use, key.ID)
+
+	case "rotate":
+		key, err := utils.RotateSigningKey(initializers.DB, use)
+		if err != nil {
+			log.Fatal("? Could not rotate key ", err)
+		}
+		fmt.Printf("? Activated %s key %s\n", use, key.ID)
+
+	case "prune":
+		tokenTTL := config.AccessTokenExpiresIn
+		if use == models.KeyUseRefresh {
+			tokenTTL = config.RefreshTokenExpiresIn
+		}
+
+		deleted, err := utils.PruneSigningKeys(initializers.DB, use, tokenTTL)
+		if err != nil {
+			log.Fatal("? Could not prune keys ", err)
+		}
+		fmt.Printf("? Deleted %d retired %s keys\n", deleted, use)
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
+
+func list() {
+	var keys []models.SigningKey
+	if err := initializers.DB.Order("use, created_at").Find(&keys).Error; err != nil {
+		log.Fatal("? Could not list keys ", err)
+	}
+
+	for _, key := range keys {
+		retired := ""
+		if key.RetiredAt != nil {
+			retired = "retired " + key.RetiredAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%-8s %-8s %s  created %s %s\n", key.Use, key.Status, key.ID, key.CreatedAt.Format(time.RFC3339), retired)
+	}
+}
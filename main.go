@@ -2,26 +2,37 @@ package main
 
 import (
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"path/filepath"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/vuongtruongson99/ocr_project/controllers"
+	"github.com/vuongtruongson99/ocr_project/email"
 	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/jobs"
+	"github.com/vuongtruongson99/ocr_project/middleware"
 	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/oidc"
 	"github.com/vuongtruongson99/ocr_project/routes"
+	"github.com/vuongtruongson99/ocr_project/storage"
 )
 
 var (
-	server         *gin.Engine
-	AuthController controllers.AuthController
-	UserController controllers.UserController
-	PostController controllers.PostController
-
-	AuthRouteController routes.AuthRouteController
-	UserRouteController routes.UserRouteController
-	PostRouteController routes.PostRouteController
+	server          *gin.Engine
+	AuthController  controllers.AuthController
+	UserController  controllers.UserController
+	PostController  controllers.PostController
+	AdminController controllers.AdminController
+	AuditController controllers.AuditController
+
+	AuthRouteController  routes.AuthRouteController
+	UserRouteController  routes.UserRouteController
+	PostRouteController  routes.PostRouteController
+	AdminRouteController routes.AdminRouteController
+	AuditRouteController routes.AuditRouteController
 )
 
 func showIndexPage(c *gin.Context) {
@@ -44,16 +55,28 @@ func init() {
 	AuthController = controllers.NewAuthController(initializers.DB)
 	UserController = controllers.NewUserController(initializers.DB)
 	PostController = controllers.NewPostController(initializers.DB)
+	AdminController = controllers.NewAdminController(initializers.DB)
+	AuditController = controllers.NewAuditController(initializers.DB)
 
 	AuthRouteController = routes.NewAuthRouteController(AuthController)
 	UserRouteController = routes.NewRouteUserController(UserController)
 	PostRouteController = routes.NewRoutePostController(PostController)
+	AdminRouteController = routes.NewRouteAdminController(AdminController)
+	AuditRouteController = routes.NewRouteAuditController(AuditController)
+
+	oidc.LoadProviders(&config)
 
 	server = gin.Default()
+	server.Use(middleware.RequestID())
+	server.SetFuncMap(template.FuncMap{
+		"oauthProviders": oidc.Providers,
+	})
 	server.LoadHTMLGlob("templates/template/*")
 	server.Static("static/", "./templates/static")
+	server.Static(storage.URLPrefix+"/"+storage.PublicDir, filepath.Join(storage.Local().Dir, storage.PublicDir))
 
 	server.GET("/", showIndexPage)
+	server.GET("/.well-known/jwks.json", controllers.JWKS)
 }
 
 func main() {
@@ -70,17 +93,25 @@ func main() {
 
 	server.Use(cors.New(corsConfig))
 
+	email.StartWorker(initializers.DB)
+	jobs.StartAccountPurger(initializers.DB)
+	jobs.StartTrashPurger(initializers.DB)
+	jobs.StartPostScheduler(initializers.DB)
+
 	router := server.Group("/api")
 	router.GET("/healthchecker", func(ctx *gin.Context) {
 		message := "Welcome to Golang with Gorm and Postgres"
 		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
 	})
 
-	router.GET("/sessions/oauth/google", controllers.GoogleOauth)
+	router.GET("/sessions/oauth/:provider/login", controllers.OauthLogin)
+	router.GET("/sessions/oauth/:provider", controllers.OauthCallback)
 
 	AuthRouteController.AuthRoute(router)
 	UserRouteController.UserRoute(router)
 	PostRouteController.PostRoute(router)
+	AdminRouteController.AdminRoute(router)
+	AuditRouteController.AuditRoute(router)
 
 	log.Fatal(server.Run(":" + config.ServerPort))
 }
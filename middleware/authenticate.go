@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
+)
+
+// Authentication methods recorded on the Principal.
+const (
+	MethodCookie = "cookie"
+	MethodBearer = "bearer"
+	MethodAPIKey = "api_key"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does not
+// carry its kind of credential, so the next one in the chain is tried.
+var ErrNoCredentials = errors.New("You are not logged in")
+
+// errUserNotFound maps to 403 rather than 401: the credential was valid.
+var errUserNotFound = errors.New("the user belonging to this token no logger exists")
+
+// errImpersonationEnded is returned when the admin behind an impersonation
+// token was signed out, suspended or lost the right to impersonate.
+var errImpersonationEnded = errors.New("This impersonation has ended, please log in again")
+
+// Principal is the authenticated caller. It is the same for every provider and
+// credential type; Method only tells how the request proved who it is.
+type Principal struct {
+	User   models.User
+	Method string
+	// APIKey is set when Method is MethodAPIKey; its scopes limit the request.
+	APIKey *models.APIKey
+	// ImpersonatorID is the admin acting as User, or uuid.Nil.
+	ImpersonatorID uuid.UUID
+	// SessionID is the session of an access token, the admin's one when
+	// impersonating, or uuid.Nil for API keys.
+	SessionID uuid.UUID
+}
+
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*Principal, error)
+}
+
+// CookieAuthenticator reads the access token set by every sign-in flow.
+type CookieAuthenticator struct{}
+
+func (CookieAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	cookie, err := c.Cookie("access_token")
+	if err != nil || cookie == "" {
+		return nil, ErrNoCredentials
+	}
+
+	return principalFromAccessToken(cookie, MethodCookie)
+}
+
+// BearerAuthenticator reads a JWT access token from "Authorization: Bearer".
+type BearerAuthenticator struct{}
+
+func (BearerAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	token := bearerToken(c)
+	if token == "" || utils.IsAPIKey(token) {
+		return nil, ErrNoCredentials
+	}
+
+	return principalFromAccessToken(token, MethodBearer)
+}
+
+// APIKeyAuthenticator reads a personal API key from "X-API-Key" or from
+// "Authorization: Bearer".
+type APIKeyAuthenticator struct{}
+
+func (APIKeyAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	key := c.Request.Header.Get("X-API-Key")
+	if key == "" {
+		key = bearerToken(c)
+	}
+	if key == "" || !utils.IsAPIKey(key) {
+		return nil, ErrNoCredentials
+	}
+
+	apiKey, err := utils.FindAPIKey(initializers.DB, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	result := initializers.DB.First(&user, "id = ?", apiKey.UserID)
+	if result.Error != nil {
+		return nil, errUserNotFound
+	}
+	if user.SuspendedAt != nil {
+		return nil, utils.ErrAccountSuspended
+	}
+
+	utils.TouchAPIKey(initializers.DB, apiKey, c.ClientIP())
+
+	return &Principal{User: user, Method: MethodAPIKey, APIKey: apiKey}, nil
+}
+
+func bearerToken(c *gin.Context) string {
+	fields := strings.Fields(c.Request.Header.Get("Authorization"))
+	if len(fields) != 2 || fields[0] != "Bearer" {
+		return ""
+	}
+	return fields[1]
+}
+
+func principalFromAccessToken(token string, method string) (*Principal, error) {
+	// Only access tokens: an MFA token means the second factor is not done yet
+	claims, err := utils.ValidateToken(token, utils.TokenTypeAccess, utils.AccessKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	result := initializers.DB.First(&user, "id = ?", claims.Subject)
+	if result.Error != nil {
+		return nil, errUserNotFound
+	}
+	if user.SuspendedAt != nil {
+		return nil, utils.ErrAccountSuspended
+	}
+
+	principal := &Principal{User: user, Method: method}
+	if claims.Impersonator != "" {
+		if principal.ImpersonatorID, err = uuid.Parse(claims.Impersonator); err != nil {
+			return nil, err
+		}
+		if err := checkImpersonator(principal.ImpersonatorID, claims.SessionID); err != nil {
+			return nil, err
+		}
+	} else if err := utils.CheckSession(initializers.DB, user.ID, claims.SessionID); err != nil {
+		// Signing a session out must end its access tokens too, not just refresh
+		return nil, err
+	}
+
+	principal.SessionID, _ = uuid.Parse(claims.SessionID)
+	return principal, nil
+}
+
+// checkImpersonator ends an impersonation as soon as the admin's own session
+// is revoked, or the admin is suspended or may no longer impersonate.
+func checkImpersonator(impersonatorID uuid.UUID, sessionID string) error {
+	if err := utils.CheckSession(initializers.DB, impersonatorID, sessionID); err != nil {
+		return errImpersonationEnded
+	}
+
+	var impersonator models.User
+	if result := initializers.DB.First(&impersonator, "id = ?", impersonatorID); result.Error != nil {
+		return errImpersonationEnded
+	}
+	if impersonator.SuspendedAt != nil || !utils.HasPermission(initializers.DB, impersonator.Role, models.PermUsersImpersonate) {
+		return errImpersonationEnded
+	}
+	return nil
+}
+
+// Authenticate tries each authenticator in order and stores the first
+// principal found as "principal" and its user as "currentUser".
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if errors.Is(err, errUserNotFound) || errors.Is(err, utils.ErrAccountSuspended) {
+				abortWithError(c, http.StatusForbidden, err.Error())
+				return
+			}
+			if err != nil {
+				abortWithError(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			c.Set("principal", principal)
+			c.Set("currentUser", principal.User)
+			if principal.ImpersonatorID != uuid.Nil {
+				c.Set("impersonatorID", principal.ImpersonatorID)
+			}
+			if principal.SessionID != uuid.Nil {
+				c.Set("sessionID", principal.SessionID)
+			}
+			c.Next()
+			return
+		}
+
+		abortWithError(c, http.StatusUnauthorized, ErrNoCredentials.Error())
+	}
+}
+
+// DeserializeUser is the authenticator chain used by every protected route.
+// It does not accept API keys, so account management stays session-only.
+func DeserializeUser() gin.HandlerFunc {
+	return Authenticate(BearerAuthenticator{}, CookieAuthenticator{})
+}
+
+// DeserializeUserOrAPIKey also accepts API keys. Routes using it must check
+// the key's scope with RequireScope.
+func DeserializeUserOrAPIKey() gin.HandlerFunc {
+	return Authenticate(APIKeyAuthenticator{}, BearerAuthenticator{}, CookieAuthenticator{})
+}
+
+// abortWithError renders home.html for browsers and JSON for everything else.
+func abortWithError(c *gin.Context, status int, message string) {
+	switch c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) {
+	case gin.MIMEHTML:
+		c.HTML(status, "home.html", gin.H{"status": "fail", "message": message})
+		c.Abort()
+	default:
+		c.AbortWithStatusJSON(status, gin.H{"status": "fail", "message": message})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DenyImpersonation must run after DeserializeUser. It keeps an impersonating
+// admin to read-only requests, so they can look at the account but not take
+// it over by changing its password, keys or second factor.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if impersonating(c) && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			abortWithError(c, http.StatusForbidden, "This action is not allowed while impersonating a user")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DenyImpersonatedReads also refuses reads, for routes that hand out the
+// user's data in bulk or list their credentials.
+func DenyImpersonatedReads() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if impersonating(c) {
+			abortWithError(c, http.StatusForbidden, "This page is not available while impersonating a user")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func impersonating(c *gin.Context) bool {
+	_, ok := c.Get("impersonatorID")
+	return ok
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+)
+
+// RequireMFAEnrollment must run after DeserializeUser. Members of a role with
+// RequireMFA are blocked until they have enrolled in two-factor authentication.
+func RequireMFAEnrollment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser := c.MustGet("currentUser").(models.User)
+
+		if !currentUser.TOTPEnabled {
+			var role models.Role
+			result := initializers.DB.First(&role, "name = ?", currentUser.Role)
+			if result.Error == nil && role.RequireMFA {
+				abortWithError(c, http.StatusForbidden, "Your role requires two-factor authentication, please enroll at /api/users/me/mfa/totp")
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
+)
+
+// RequirePermission must run after DeserializeUser.
+// It aborts with 403 unless the current user's role grants the permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser := c.MustGet("currentUser").(models.User)
+
+		if !utils.HasPermission(initializers.DB, currentUser.Role, permission) {
+			abortWithError(c, http.StatusForbidden, "You do not have permission to perform this action")
+			return
+		}
+
+		c.Next()
+	}
+}
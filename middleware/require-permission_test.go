@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils/rbactest"
+)
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	initializers.DB = rbactest.DB()
+
+	tests := []struct {
+		name       string
+		role       string
+		permission string
+		want       int
+	}{
+		{"user creating a post", models.RoleUser, models.PermPostsCreate, http.StatusOK},
+		{"user deleting any post", models.RoleUser, models.PermPostsDeleteAny, http.StatusForbidden},
+		{"moderator deleting any post", models.RoleModerator, models.PermPostsDeleteAny, http.StatusOK},
+		{"moderator updating any post", models.RoleModerator, models.PermPostsUpdateAny, http.StatusForbidden},
+		{"moderator assigning roles", models.RoleModerator, models.PermRolesAssign, http.StatusForbidden},
+		{"admin assigning roles", models.RoleAdmin, models.PermRolesAssign, http.StatusOK},
+		{"unknown role", "guest", models.PermPostsRead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/",
+				func(c *gin.Context) {
+					c.Set("currentUser", models.User{ID: uuid.New(), Role: tt.role})
+				},
+				RequirePermission(tt.permission),
+				func(c *gin.Context) {
+					c.Status(http.StatusOK)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
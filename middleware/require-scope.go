@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope must run after DeserializeUserOrAPIKey. Requests made with an
+// API key are rejected unless the key was granted the scope; session and
+// bearer token requests pass through.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := c.MustGet("principal").(*Principal)
+
+		if principal.Method == MethodAPIKey && !principal.APIKey.HasScope(scope) {
+			abortWithError(c, http.StatusForbidden, "This API key is missing the \""+scope+"\" scope")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/vuongtruongson99/ocr_project/audit"
 	"github.com/vuongtruongson99/ocr_project/initializers"
 	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils"
 )
 
 func init() {
@@ -18,6 +20,15 @@ func init() {
 }
 
 func main() {
-	initializers.DB.AutoMigrate(&models.User{}, &models.Post{})
+	initializers.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Permission{}, &models.Role{}, &models.AuditLog{}, &models.EmailOutbox{}, &models.RefreshToken{}, &models.Session{}, &models.UserIdentity{}, &models.RecoveryCode{}, &models.APIKey{}, &models.LoginThrottle{}, &models.SigningKey{}, &models.Generation{}, &models.PostRevision{})
 	fmt.Println("? Migration complete")
+
+	if err := audit.Migrate(initializers.DB); err != nil {
+		log.Fatal("? Could not make the audit log append-only", err)
+	}
+
+	if err := utils.SeedRoles(initializers.DB); err != nil {
+		log.Fatal("? Could not seed roles", err)
+	}
+	fmt.Println("? Roles seeded")
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSearchQuery filters the admin user list. Empty fields match everyone.
+type UserSearchQuery struct {
+	Email         string     `form:"email"`
+	Provider      string     `form:"provider"`
+	Role          string     `form:"role"`
+	Verified      *bool      `form:"verified"`
+	Suspended     *bool      `form:"suspended"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02"`
+	Page          int        `form:"page,default=1" binding:"min=1"`
+	Limit         int        `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+type SuspendUserInput struct {
+	Reason string `form:"reason" json:"reason" binding:"required,max=255"`
+}
+
+// AdminUserResponse is what admins see of a user.
+type AdminUserResponse struct {
+	ID                    uuid.UUID  `json:"id"`
+	Name                  string     `json:"name"`
+	Email                 string     `json:"email"`
+	Role                  string     `json:"role"`
+	Provider              string     `json:"provider"`
+	Photo                 string     `json:"photo"`
+	Verified              bool       `json:"verified"`
+	TOTPEnabled           bool       `json:"totp_enabled"`
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	SuspendedReason       string     `json:"suspended_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions.
+const (
+	AuditRoleChange         = "role.change"
+	AuditIdentityLink       = "identity.link"
+	AuditIdentityUnlink     = "identity.unlink"
+	AuditRoleUpdate         = "role.update"
+	AuditMFAEnable          = "mfa.enable"
+	AuditMFADisable         = "mfa.disable"
+	AuditMFARecoveryCodes   = "mfa.recovery_codes"
+	AuditAPIKeyCreate       = "apikey.create"
+	AuditAPIKeyRevoke       = "apikey.revoke"
+	AuditLockoutLift        = "lockout.lift"
+	AuditPasswordChange     = "password.change"
+	AuditAccountDelete      = "account.delete"
+	AuditAccountRestore     = "account.restore"
+	AuditAccountExport      = "account.export"
+	AuditUserSuspend        = "user.suspend"
+	AuditUserUnsuspend      = "user.unsuspend"
+	AuditPasswordResetForce = "password.reset_force"
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationStop  = "impersonation.stop"
+	AuditLoginSuccess       = "login.success"
+	AuditLoginFailure       = "login.failure"
+	AuditTokenRefresh       = "token.refresh"
+	AuditTokenReuse         = "token.reuse"
+	AuditPostUpdate         = "post.update"
+	AuditPostDelete         = "post.delete"
+	AuditPostRestore        = "post.restore"
+	AuditPostPurge          = "post.purge"
+	AuditExport             = "audit.export"
+)
+
+type AuditLog struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	// Seq orders the events, and the hash chain with them.
+	Seq       int64     `gorm:"autoIncrement;uniqueIndex;not null" json:"seq"`
+	ActorID   uuid.UUID `gorm:"type:uuid;index" json:"actor_id"`
+	Action    string    `gorm:"type:varchar(255);index;not null" json:"action"`
+	Target    string    `gorm:"type:varchar(255);index" json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `gorm:"type:varchar(64);index" json:"request_id"`
+	Metadata  string    `gorm:"type:jsonb" json:"metadata"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	// PrevHash and Hash are set when AUDIT_HASH_CHAIN is on, see package audit.
+	PrevHash string `gorm:"type:varchar(64)" json:"prev_hash,omitempty"`
+	Hash     string `gorm:"type:varchar(64)" json:"hash,omitempty"`
+}
+
+// AuditQuery filters the audit log. Empty fields match every event.
+type AuditQuery struct {
+	ActorID   string     `form:"actor_id" binding:"omitempty,uuid"`
+	Action    string     `form:"action"`
+	Target    string     `form:"target"`
+	RequestID string     `form:"request_id"`
+	IP        string     `form:"ip"`
+	From      *time.Time `form:"from" time_format:"2006-01-02"`
+	To        *time.Time `form:"to" time_format:"2006-01-02"`
+	Page      int        `form:"page,default=1" binding:"min=1"`
+	Limit     int        `form:"limit,default=50" binding:"min=1,max=500"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outbox statuses.
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// EmailOutbox is a rendered email waiting to be delivered by the email worker.
+// The bodies are scrubbed once it is sent or has failed for good, and the row
+// is deleted a week later.
+type EmailOutbox struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	To            string    `gorm:"not null"`
+	Subject       string    `gorm:"not null"`
+	HTMLBody      string    `gorm:"type:text;not null"`
+	TextBody      string    `gorm:"type:text;not null"`
+	Status        string    `gorm:"type:varchar(16);index;not null"`
+	Attempts      int       `gorm:"not null"`
+	LastError     string
+	NextAttemptAt time.Time `gorm:"index;not null"`
+	SentAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Generation is one text-to-image request. The image itself is kept in the
+// blob store under ImageKey.
+type Generation struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+	Model       string    `gorm:"not null" json:"model"`
+	Prompt      string    `gorm:"not null" json:"prompt"`
+	ImageKey    string    `gorm:"not null" json:"image_key"`
+	ContentType string    `gorm:"not null" json:"content_type"`
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to an account at an OAuth/OIDC provider. A user
+// can have a password and any number of identities.
+type UserIdentity struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID      uuid.UUID `gorm:"type:uuid;index;not null"`
+	Provider    string    `gorm:"type:varchar(64);uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject     string    `gorm:"type:varchar(255);uniqueIndex:idx_identity_provider_subject;not null"`
+	Email       string
+	CreatedAt   time.Time `gorm:"not null"`
+	LastLoginAt time.Time
+}
+
+type IdentityResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// ReauthInput confirms a sensitive action. Password is required when the user
+// has one; accounts without a password must have signed in recently instead.
+type ReauthInput struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login throttle kinds.
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// LoginThrottle counts recent failed sign-in attempts for one account (keyed by
+// email, so unknown addresses are throttled the same way) or one client IP.
+type LoginThrottle struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	Key           string     `gorm:"type:varchar(320);uniqueIndex;not null" json:"key"`
+	Kind          string     `gorm:"type:varchar(16);not null" json:"kind"`
+	UserID        *uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
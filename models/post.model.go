@@ -1,9 +1,20 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Post statuses. Only published posts are listed for everyone; the others are
+// visible to their author and to editors.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
 )
 
 type Post struct {
@@ -14,15 +25,54 @@ type Post struct {
 	User      uuid.UUID `gorm:"not null" json:"user,omitempty"`
 	CreatedAt time.Time `gorm:"not null" json:"created_at,omitempty"`
 	UpdatedAt time.Time `gorm:"not null" json:"updated_at,omitempty"`
+	// Posts from before statuses existed were all public, hence the default.
+	Status      string     `gorm:"type:varchar(16);index;not null;default:published" json:"status"`
+	PublishAt   *time.Time `gorm:"index" json:"publish_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// DeletedAt is set while the post is in its author's trash. The title
+	// stays taken until the post is purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// SetStatus moves the post to status. A scheduled post needs a future
+// publishAt, which is ignored for every other status.
+func (p *Post) SetStatus(status string, publishAt *time.Time, now time.Time) error {
+	p.PublishAt = nil
+	switch status {
+	case PostScheduled:
+		if publishAt == nil || !publishAt.After(now) {
+			return errors.New("A scheduled post needs a publish_at in the future")
+		}
+		p.PublishAt = publishAt
+	case PostPublished:
+		if p.Status != PostPublished || p.PublishedAt == nil {
+			p.PublishedAt = &now
+		}
+	case PostDraft, PostArchived:
+	default:
+		return errors.New("Unknown post status " + status)
+	}
+
+	p.Status = status
+	return nil
+}
+
+// TrashedPostResponse is a post in the trash with when it will be purged.
+type TrashedPostResponse struct {
+	Post
+	PurgeAt time.Time `json:"purge_at"`
 }
 
 type CreatePostRequest struct {
-	Title     string    `json:"title" binding:"required"`
-	Content   string    `json:"content" binding:"required"`
-	Image     string    `json:"image" binding:"required"`
-	User      string    `json:"user,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required"`
+	Image   string `json:"image" binding:"required"`
+	// Status defaults to published, or to scheduled when PublishAt is set.
+	Status    string     `json:"status,omitempty" binding:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	User      string     `json:"user,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at,omitempty"`
 }
 
 type UpdatePost struct {
@@ -33,3 +83,8 @@ type UpdatePost struct {
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
 }
+
+type UpdatePostStatusInput struct {
+	Status    string     `json:"status" binding:"required,oneof=draft scheduled published archived"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PostRevision is a snapshot of a post taken each time it is written. Rows are
+// never updated; they go only when their post is purged.
+type PostRevision struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	PostID   uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_post_revision_number;not null" json:"post_id"`
+	Number   int       `gorm:"uniqueIndex:idx_post_revision_number;not null" json:"number"`
+	AuthorID uuid.UUID `gorm:"type:uuid;index;not null" json:"author_id"`
+	Title    string    `gorm:"not null" json:"title"`
+	Content  string    `gorm:"not null" json:"content"`
+	Image    string    `gorm:"not null" json:"image"`
+	// RestoredFrom is the revision a rollback copied.
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+}
+
+// FieldChange is one field that differs between two revisions.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// RevisionDiffQuery picks the two revisions to compare.
+type RevisionDiffQuery struct {
+	From int `form:"from" binding:"required,gte=1"`
+	To   int `form:"to" binding:"required,gte=1"`
+}
+
+type RevisionDiffResponse struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission names follow "<resource>:<action>[:<scope>]".
+const (
+	PermPostsCreate      = "posts:create"
+	PermPostsRead        = "posts:read"
+	PermPostsUpdateOwn   = "posts:update:own"
+	PermPostsUpdateAny   = "posts:update:any"
+	PermPostsDeleteOwn   = "posts:delete:own"
+	PermPostsDeleteAny   = "posts:delete:any"
+	PermGenerate         = "generate"
+	PermProfileRead      = "profile:read"
+	PermRolesRead        = "roles:read"
+	PermRolesAssign      = "roles:assign"
+	PermRolesUpdate      = "roles:update"
+	PermLockoutsManage   = "lockouts:manage"
+	PermUsersRead        = "users:read"
+	PermUsersManage      = "users:manage"
+	PermUsersImpersonate = "users:impersonate"
+	PermAuditRead        = "audit:read"
+)
+
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"`
+	Description string       `json:"description,omitempty"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+	// RequireMFA blocks members from protected routes until they enroll in 2FA.
+	RequireMFA bool      `gorm:"not null;default:false" json:"require_mfa"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DefaultPermissions are seeded on migration.
+var DefaultPermissions = map[string]string{
+	PermPostsCreate:      "Create posts",
+	PermPostsRead:        "Read posts",
+	PermPostsUpdateOwn:   "Update own posts",
+	PermPostsUpdateAny:   "Update any post",
+	PermPostsDeleteOwn:   "Delete own posts",
+	PermPostsDeleteAny:   "Delete any post",
+	PermGenerate:         "Generate images",
+	PermProfileRead:      "Read own profile",
+	PermRolesRead:        "List roles and permissions",
+	PermRolesAssign:      "Assign roles to users",
+	PermRolesUpdate:      "Change role settings such as required 2FA",
+	PermLockoutsManage:   "View and lift sign-in lockouts",
+	PermUsersRead:        "Search users and view their posts, generations and sessions",
+	PermUsersManage:      "Suspend users and force password resets",
+	PermUsersImpersonate: "Sign in as another user",
+	PermAuditRead:        "Search, export and verify the audit log",
+}
+
+// DefaultRoles maps each seeded role to its permissions.
+var DefaultRoles = map[string][]string{
+	RoleUser: {
+		PermPostsCreate, PermPostsRead, PermPostsUpdateOwn, PermPostsDeleteOwn,
+		PermGenerate, PermProfileRead,
+	},
+	RoleModerator: {
+		PermPostsCreate, PermPostsRead, PermPostsUpdateOwn, PermPostsDeleteOwn, PermPostsDeleteAny,
+		PermGenerate, PermProfileRead, PermRolesRead,
+	},
+	RoleAdmin: {
+		PermPostsCreate, PermPostsRead, PermPostsUpdateOwn, PermPostsUpdateAny, PermPostsDeleteOwn, PermPostsDeleteAny,
+		PermGenerate, PermProfileRead, PermRolesRead, PermRolesAssign, PermRolesUpdate,
+		PermLockoutsManage, PermUsersRead, PermUsersManage, PermUsersImpersonate, PermAuditRead,
+	},
+}
+
+type UpdateRoleInput struct {
+	RequireMFA *bool `json:"require_mfa" binding:"required"`
+}
+
+type AssignRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one sign-in on one device. Its ID is the FamilyID shared by every
+// refresh token rotated from that sign-in.
+type Session struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID     uuid.UUID `gorm:"type:uuid;index;not null"`
+	Provider   string    `gorm:"not null"`
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time `gorm:"not null"`
+	LastUsedAt time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Provider   string    `json:"provider"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
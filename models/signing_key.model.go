@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Signing key uses.
+const (
+	KeyUseAccess  = "access"
+	KeyUseRefresh = "refresh"
+)
+
+// Signing key states. A pending key is published and accepted but not used to
+// sign yet, so verifiers can pick it up before the rotation; a retired key is
+// still accepted until the tokens it signed have expired.
+const (
+	KeyPending = "pending"
+	KeyActive  = "active"
+	KeyRetired = "retired"
+)
+
+// SigningKey is one RSA key pair of the JWT keyring. ID is the "kid" header of
+// the tokens it signs. Keys are stored base64 PEM encoded, like the config.
+type SigningKey struct {
+	ID          string    `gorm:"type:varchar(64);primary_key"`
+	Use         string    `gorm:"type:varchar(16);index;not null"`
+	Status      string    `gorm:"type:varchar(16);index;not null"`
+	PrivateKey  string    `gorm:"not null"`
+	PublicKey   string    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ActivatedAt *time.Time
+	RetiredAt   *time.Time
+}
@@ -4,6 +4,14 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles a user can hold. Every account starts as RoleUser.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
 )
 
 type User struct {
@@ -18,15 +26,85 @@ type User struct {
 	Verified  bool      `gorm:"not null"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// VerificationCode holds the SHA-256 of the code mailed to local sign-ups.
+	VerificationCode          string `gorm:"index"`
+	VerificationCodeExpiresAt time.Time
+
+	// PasswordResetToken holds the SHA-256 of the emailed reset token.
+	PasswordResetToken string `gorm:"index"`
+	PasswordResetAt    time.Time
+	PasswordChangedAt  time.Time
+
+	// AccountRestoreToken holds the SHA-256 of the emailed link that undoes
+	// an account deletion during the grace period.
+	AccountRestoreToken string `gorm:"index"`
+
+	// TOTPSecret is set on enrollment; TOTPEnabled once the first code is verified.
+	TOTPSecret  string
+	TOTPEnabled bool `gorm:"not null;default:false"`
+	// TOTPLastStep is the time step of the last accepted code, which can't
+	// be used again.
+	TOTPLastStep int64 `gorm:"not null;default:0"`
+
+	// SuspendedAt is set while an admin has suspended the account, which
+	// blocks every sign-in and request.
+	SuspendedAt     *time.Time
+	SuspendedReason string
+	// PasswordResetRequired is set by an admin; password sign-in is refused
+	// until the user resets their password.
+	PasswordResetRequired bool `gorm:"not null;default:false"`
+
+	// DeletedAt is set when the user deletes their account. The account and
+	// its data are purged once the grace period has passed.
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type SignUpInput struct {
 	Name            string `form:"name" binding:"required"`
-	Email           string `form:"email" binding:"required"`
-	Password        string `form:"password" binding:"required,min=8"`
+	Email           string `form:"email" binding:"required,email"`
+	Password        string `form:"password" binding:"required"`
 	PasswordConfirm string `form:"passwordConfirm" binding:"required"`
 }
 
+type ResendVerificationInput struct {
+	Email string `form:"email" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `form:"email" json:"email" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Password        string `form:"password" json:"password" binding:"required"`
+	PasswordConfirm string `form:"passwordConfirm" json:"passwordConfirm" binding:"required"`
+}
+
+type UpdateMeInput struct {
+	Name  *string `form:"name" json:"name" binding:"omitempty,min=1,max=255"`
+	Photo *string `form:"photo" json:"photo" binding:"omitempty,url"`
+}
+
+// AccountExport is profile.json in the personal data export.
+type AccountExport struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Photo       string    `json:"photo"`
+	Provider    string    `json:"provider"`
+	Verified    bool      `json:"verified"`
+	TOTPEnabled bool      `json:"totp_enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `form:"currentPassword" json:"currentPassword"`
+	Password        string `form:"password" json:"password" binding:"required"`
+	PasswordConfirm string `form:"passwordConfirm" json:"passwordConfirm" binding:"required"`
+}
+
 type SignInInput struct {
 	Email    string `form:"email" binding:"required"`
 	Password string `form:"password" binding:"required"`
@@ -44,6 +122,17 @@ type UserResponse struct {
 }
 
 type GenerateImage struct {
-	Model  string `form:"selectModel" binding:"required"`
-	Prompt string `form:"prompt" binding:"required"`
+	Model  string `form:"selectModel" json:"model" binding:"required"`
+	Prompt string `form:"prompt" json:"prompt" binding:"required"`
+}
+
+type MFACodeInput struct {
+	Code string `form:"code" json:"code" binding:"required"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURL string `json:"otpauth_url"`
+	// QRCode is a base64 PNG of OtpauthURL.
+	QRCode string `json:"qr_code"`
 }
@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// oauth2User covers the userinfo shape of GitHub and similar providers.
+type oauth2User struct {
+	ID        json.Number `json:"id"`
+	Login     string      `json:"login"`
+	Name      string      `json:"name"`
+	Email     string      `json:"email"`
+	AvatarURL string      `json:"avatar_url"`
+}
+
+type oauth2Email struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// oauth2UserInfo reads the profile from the userinfo API. The public profile
+// email is not known to be verified, so the verified primary address from
+// EmailsURL is preferred when available.
+func (p *Provider) oauth2UserInfo(token *Token) (*UserInfo, error) {
+	var user oauth2User
+	if err := getJSON(p.Config.UserinfoURL, token.AccessToken, &user); err != nil {
+		return nil, fmt.Errorf("could not retrieve user: %w", err)
+	}
+
+	if user.ID.String() == "" {
+		return nil, errors.New("provider did not return a user id")
+	}
+
+	info := &UserInfo{
+		Subject: user.ID.String(),
+		Email:   strings.ToLower(user.Email),
+		Name:    user.Name,
+		Picture: user.AvatarURL,
+	}
+	if info.Name == "" {
+		info.Name = user.Login
+	}
+
+	if p.Config.EmailsURL != "" {
+		var emails []oauth2Email
+		if err := getJSON(p.Config.EmailsURL, token.AccessToken, &emails); err == nil {
+			for _, email := range emails {
+				if email.Primary && email.Verified {
+					info.Email = strings.ToLower(email.Email)
+					info.EmailVerified = true
+				}
+			}
+		}
+	}
+
+	if info.Email == "" {
+		return nil, errors.New("provider did not return an email address")
+	}
+
+	return info, nil
+}
@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/vuongtruongson99/ocr_project/oidc/oidctest"
+)
+
+const testClientID = "ocr-client"
+
+func newTestProvider(issuer *oidctest.Issuer) *Provider {
+	return NewProvider(ProviderConfig{
+		Name:     "local",
+		ClientID: testClientID,
+		Issuer:   issuer.URL,
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID)
+	defer issuer.Close()
+
+	metadata, err := Discover(issuer.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.JwksURI != issuer.URL+"/jwks" {
+		t.Errorf("JwksURI = %q", metadata.JwksURI)
+	}
+
+	// A document describing another issuer must not be trusted
+	issuer.MetadataIssuer = "https://accounts.example.com"
+	if _, err := Discover(issuer.URL); err == nil {
+		t.Error("Discover() accepted metadata for another issuer")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID)
+	defer issuer.Close()
+	provider := newTestProvider(issuer)
+
+	strangerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := issuer.Claims("nonce-1")
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", issuer.Sign(claims(nil)), "nonce-1", false},
+		{"one of several audiences", issuer.Sign(claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{"another-client", testClientID}
+		})), "nonce-1", false},
+		{"bad aud", issuer.Sign(claims(func(c jwt.MapClaims) { c["aud"] = "another-client" })), "nonce-1", true},
+		{"bad iss", issuer.Sign(claims(func(c jwt.MapClaims) { c["iss"] = "https://accounts.example.com" })), "nonce-1", true},
+		{"bad nonce", issuer.Sign(claims(nil)), "nonce-2", true},
+		{"no nonce expected", issuer.Sign(claims(func(c jwt.MapClaims) { delete(c, "nonce") })), "", true},
+		{"expired", issuer.Sign(claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), "nonce-1", true},
+		{"no subject", issuer.Sign(claims(func(c jwt.MapClaims) { delete(c, "sub") })), "nonce-1", true},
+		{"bad kid", issuer.SignWithKid(claims(nil), "unknown-key", strangerKey), "nonce-1", true},
+		{"known kid, wrong key", issuer.SignWithKid(claims(nil), "key-1", strangerKey), "nonce-1", true},
+		{"not RSA", func() string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+			return signed
+		}(), "nonce-1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := provider.VerifyIDToken(tt.token, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Subject != issuer.Subject {
+				t.Errorf("Subject = %q, want %q", got.Subject, issuer.Subject)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID)
+	defer issuer.Close()
+	provider := newTestProvider(issuer)
+
+	oldToken := issuer.Sign(issuer.Claims("nonce-1"))
+	if _, err := provider.VerifyIDToken(oldToken, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.RotateKey(true)
+	newToken := issuer.Sign(issuer.Claims("nonce-1"))
+
+	// Unknown kids do not reload the keys more than once a minute
+	if _, err := provider.VerifyIDToken(newToken, "nonce-1"); err == nil {
+		t.Error("VerifyIDToken() reloaded the keys within minRefreshInterval")
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+
+	provider.keys.refreshedAt = time.Now().Add(-minRefreshInterval)
+	if _, err := provider.VerifyIDToken(newToken, "nonce-1"); err != nil {
+		t.Errorf("VerifyIDToken() after rotation: %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+
+	// The retired key is gone with the reload
+	if _, err := provider.VerifyIDToken(oldToken, "nonce-1"); err == nil {
+		t.Error("VerifyIDToken() accepted a token signed with a retired key")
+	}
+}
+
+func TestOauth2UserInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		profileEmail string
+		emails       []oauth2Email
+		wantEmail    string
+		wantVerified bool
+		wantErr      bool
+	}{
+		{
+			name:         "verified primary preferred",
+			profileEmail: "public@example.com",
+			emails: []oauth2Email{
+				{Email: "other@example.com", Verified: true},
+				{Email: "Jane@Example.com", Primary: true, Verified: true},
+			},
+			wantEmail:    "jane@example.com",
+			wantVerified: true,
+		},
+		{
+			name:         "unverified primary ignored",
+			profileEmail: "public@example.com",
+			emails:       []oauth2Email{{Email: "jane@example.com", Primary: true}},
+			wantEmail:    "public@example.com",
+		},
+		{
+			name:         "verified secondary ignored",
+			profileEmail: "",
+			emails:       []oauth2Email{{Email: "jane@example.com", Verified: true}},
+			wantErr:      true,
+		},
+		{
+			name:         "emails endpoint unavailable",
+			profileEmail: "public@example.com",
+			wantEmail:    "public@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": 583231, "login": "jane", "email": tt.profileEmail})
+			})
+			mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer access-token" || tt.emails == nil {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+				json.NewEncoder(w).Encode(tt.emails)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			provider := NewProvider(ProviderConfig{
+				Name:        "github",
+				UserinfoURL: server.URL + "/user",
+				EmailsURL:   server.URL + "/user/emails",
+			})
+
+			info, err := provider.UserInfo(&Token{AccessToken: "access-token"}, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UserInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if info.Subject != "583231" || info.Name != "jane" {
+				t.Errorf("UserInfo() = %+v", info)
+			}
+			if info.Email != tt.wantEmail || info.EmailVerified != tt.wantVerified {
+				t.Errorf("email = %q verified %v, want %q verified %v", info.Email, info.EmailVerified, tt.wantEmail, tt.wantVerified)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+// Package oidctest runs a local OpenID Connect issuer for tests. It serves
+// discovery, JWKS, an authorize endpoint that consents at once and a token
+// endpoint that enforces PKCE, and signs id_tokens with keys it can rotate.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type signingKey struct {
+	id      string
+	private *rsa.PrivateKey
+}
+
+type authRequest struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+}
+
+// Issuer is a running mock issuer. Close it when done.
+type Issuer struct {
+	*httptest.Server
+
+	ClientID string
+	// Subject, Email and EmailVerified go into every id_token it issues.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// MetadataIssuer overrides the issuer in the discovery document.
+	MetadataIssuer string
+
+	mu            sync.Mutex
+	keys          []*signingKey
+	codes         map[string]authRequest
+	keyGeneration int
+	jwksRequests  int
+}
+
+// NewIssuer starts an issuer for clientID with one signing key.
+func NewIssuer(clientID string) *Issuer {
+	issuer := &Issuer{
+		ClientID:      clientID,
+		Subject:       "248289761001",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		codes:         map[string]authRequest{},
+	}
+	issuer.RotateKey(false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+// RotateKey signs new tokens with a fresh key. The old keys stay published
+// unless dropOld is set.
+func (i *Issuer) RotateKey(dropOld bool) string {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.keyGeneration++
+	key := &signingKey{id: "key-" + strconv.Itoa(i.keyGeneration), private: private}
+	if dropOld {
+		i.keys = nil
+	}
+	i.keys = append(i.keys, key)
+	return key.id
+}
+
+// JWKSRequests counts how often the key set was fetched.
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+// Claims returns valid id_token claims for the nonce, to be altered by tests.
+func (i *Issuer) Claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL,
+		"aud":            i.ClientID,
+		"sub":            i.Subject,
+		"nonce":          nonce,
+		"email":          i.Email,
+		"email_verified": i.EmailVerified,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// Sign signs the claims with the current key, naming it in "kid".
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	i.mu.Lock()
+	key := i.keys[len(i.keys)-1]
+	i.mu.Unlock()
+
+	return i.SignWithKid(claims, key.id, key.private)
+}
+
+// SignWithKid signs the claims with any key under any kid.
+func (i *Issuer) SignWithKid(claims jwt.MapClaims, kid string, private *rsa.PrivateKey) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(private)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := i.URL
+	if i.MetadataIssuer != "" {
+		issuer = i.MetadataIssuer
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.jwksRequests++
+	keys := make([]map[string]string, 0, len(i.keys))
+	for _, key := range i.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": key.id,
+			"n":   base64.RawURLEncoding.EncodeToString(key.private.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.private.E)).Bytes()),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// authorize consents at once and redirects back with a code.
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code := base64.RawURLEncoding.EncodeToString(random)
+
+	i.mu.Lock()
+	i.codes[code] = authRequest{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+	}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client and the PKCE verifier.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	request, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || request.clientID != r.PostForm.Get("client_id") || request.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != request.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     i.Sign(i.Claims(request.nonce)),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,230 @@
+// Package oidc implements sign-in with any OpenID Connect issuer, using
+// discovery and JWKS-verified id_tokens, and with plain OAuth2 providers such
+// as GitHub that only expose a userinfo API.
+package oidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type ProviderConfig struct {
+	// Name is the URL slug, e.g. /api/sessions/oauth/<name>/login
+	Name         string
+	DisplayName  string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Issuer enables OIDC discovery and id_token verification.
+	Issuer string
+
+	// Plain OAuth2 endpoints, used when Issuer is empty.
+	AuthURL     string
+	TokenURL    string
+	UserinfoURL string
+	// EmailsURL lists the user's addresses when userinfo omits them (GitHub).
+	EmailsURL string
+}
+
+// UserInfo is what every provider is reduced to.
+type UserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Token is the token endpoint response.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+type Provider struct {
+	Config ProviderConfig
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	return &Provider{Config: config}
+}
+
+// IsOIDC reports whether the provider issues verifiable id_tokens.
+func (p *Provider) IsOIDC() bool {
+	return p.Config.Issuer != ""
+}
+
+// endpoints resolves the provider endpoints, running discovery once for OIDC issuers.
+func (p *Provider) endpoints() (*Metadata, error) {
+	if !p.IsOIDC() {
+		return &Metadata{
+			AuthorizationEndpoint: p.Config.AuthURL,
+			TokenEndpoint:         p.Config.TokenURL,
+			UserinfoEndpoint:      p.Config.UserinfoURL,
+		}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata == nil {
+		metadata, err := Discover(p.Config.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		p.metadata = metadata
+		p.keys = newKeySet(metadata.JwksURI)
+	}
+
+	return p.metadata, nil
+}
+
+// AuthCodeURL builds the consent page URL for one login flow.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) (string, error) {
+	metadata, err := p.endpoints()
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	values.Add("client_id", p.Config.ClientID)
+	values.Add("redirect_uri", p.Config.RedirectURL)
+	values.Add("response_type", "code")
+	values.Add("scope", strings.Join(p.Config.Scopes, " "))
+	values.Add("state", state)
+	values.Add("code_challenge", codeChallenge)
+	values.Add("code_challenge_method", "S256")
+	if p.IsOIDC() {
+		values.Add("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + values.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens.
+func (p *Provider) Exchange(code string, codeVerifier string) (*Token, error) {
+	metadata, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	values.Add("grant_type", "authorization_code")
+	values.Add("code", code)
+	values.Add("client_id", p.Config.ClientID)
+	values.Add("client_secret", p.Config.ClientSecret)
+	values.Add("redirect_uri", p.Config.RedirectURL)
+	values.Add("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", metadata.TokenEndpoint, bytes.NewBufferString(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token Token
+	if err := doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("could not retrieve token: %w", err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, errors.New("could not retrieve token: no access_token in response")
+	}
+
+	return &token, nil
+}
+
+// UserInfo resolves the signed-in user. For OIDC providers the id_token is
+// verified against the issuer's JWKS and must carry the flow's nonce.
+func (p *Provider) UserInfo(token *Token, nonce string) (*UserInfo, error) {
+	if !p.IsOIDC() {
+		return p.oauth2UserInfo(token)
+	}
+
+	if token.IDToken == "" {
+		return nil, errors.New("provider did not return an id_token")
+	}
+
+	claims, err := p.VerifyIDToken(token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	info := claims.userInfo()
+
+	// Some issuers keep profile claims out of the id_token
+	if info.Email == "" {
+		metadata, err := p.endpoints()
+		if err != nil {
+			return nil, err
+		}
+		if metadata.UserinfoEndpoint == "" {
+			return nil, errors.New("provider did not return an email address")
+		}
+
+		var userinfo idTokenClaims
+		if err := getJSON(metadata.UserinfoEndpoint, token.AccessToken, &userinfo); err != nil {
+			return nil, fmt.Errorf("could not retrieve user: %w", err)
+		}
+		if userinfo.Subject != info.Subject {
+			return nil, errors.New("userinfo subject does not match id_token")
+		}
+
+		info = userinfo.userInfo()
+	}
+
+	return info, nil
+}
+
+func getJSON(endpoint string, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v interface{}) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, res.Status)
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"strings"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+)
+
+// presets fill in well-known endpoints so only client credentials need configuring.
+// Any other OIDC issuer (Keycloak, Auth0, a local mock, ...) just sets ISSUER.
+var presets = map[string]ProviderConfig{
+	"google": {
+		DisplayName: "Google",
+		Issuer:      "https://accounts.google.com",
+		Scopes:      []string{"openid", "profile", "email"},
+	},
+	"github": {
+		DisplayName: "GitHub",
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserinfoURL: "https://api.github.com/user",
+		EmailsURL:   "https://api.github.com/user/emails",
+		Scopes:      []string{"read:user", "user:email"},
+	},
+}
+
+var (
+	providers []*Provider
+	byName    = map[string]*Provider{}
+)
+
+// LoadProviders reads OIDC_PROVIDERS (comma separated names) and for each name
+// OIDC_<NAME>_{CLIENT_ID,CLIENT_SECRET,REDIRECT_URL,ISSUER,DISPLAY_NAME,SCOPES,
+// AUTH_URL,TOKEN_URL,USERINFO_URL,EMAILS_URL}. The legacy GOOGLE_OAUTH_* keys
+// still configure Google.
+func LoadProviders(config *initializers.Config) {
+	providers = nil
+	byName = map[string]*Provider{}
+
+	names := strings.Split(config.OidcProviders, ",")
+	if config.OidcProviders == "" && config.GoogleClientID != "" {
+		names = []string{"google"}
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || byName[name] != nil {
+			continue
+		}
+
+		providerConfig := presets[name]
+		providerConfig.Name = name
+		setting := func(key string, fallback string) string {
+			if value := initializers.OidcProviderSetting(name, key); value != "" {
+				return value
+			}
+			return fallback
+		}
+
+		if name == "google" {
+			providerConfig.ClientID = config.GoogleClientID
+			providerConfig.ClientSecret = config.GoogleClientSecret
+			providerConfig.RedirectURL = config.GoogleOauthRedirectURL
+		}
+
+		providerConfig.ClientID = setting("CLIENT_ID", providerConfig.ClientID)
+		providerConfig.ClientSecret = setting("CLIENT_SECRET", providerConfig.ClientSecret)
+		providerConfig.RedirectURL = setting("REDIRECT_URL", providerConfig.RedirectURL)
+		providerConfig.Issuer = setting("ISSUER", providerConfig.Issuer)
+		providerConfig.DisplayName = setting("DISPLAY_NAME", providerConfig.DisplayName)
+		providerConfig.AuthURL = setting("AUTH_URL", providerConfig.AuthURL)
+		providerConfig.TokenURL = setting("TOKEN_URL", providerConfig.TokenURL)
+		providerConfig.UserinfoURL = setting("USERINFO_URL", providerConfig.UserinfoURL)
+		providerConfig.EmailsURL = setting("EMAILS_URL", providerConfig.EmailsURL)
+		if scopes := setting("SCOPES", ""); scopes != "" {
+			providerConfig.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+
+		if providerConfig.DisplayName == "" {
+			providerConfig.DisplayName = name
+		}
+		if providerConfig.Issuer != "" && len(providerConfig.Scopes) == 0 {
+			providerConfig.Scopes = []string{"openid", "profile", "email"}
+		}
+
+		if providerConfig.ClientID == "" || (providerConfig.Issuer == "" && providerConfig.AuthURL == "") {
+			continue
+		}
+
+		provider := NewProvider(providerConfig)
+		providers = append(providers, provider)
+		byName[name] = provider
+	}
+}
+
+// Get returns the configured provider with that name.
+func Get(name string) (*Provider, bool) {
+	provider, ok := byName[name]
+	return provider, ok
+}
+
+// Providers lists the configured providers in OIDC_PROVIDERS order; the
+// sign-in page renders one button per provider.
+func Providers() []*Provider {
+	return providers
+}
@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type idTokenClaims struct {
+	jwt.StandardClaims
+	Audience      interface{} `json:"aud"`
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Picture       string      `json:"picture"`
+}
+
+// Valid checks exp/iat/nbf; audience and issuer are checked by VerifyIDToken.
+func (c *idTokenClaims) Valid() error {
+	return c.StandardClaims.Valid()
+}
+
+func (c *idTokenClaims) audiences() []string {
+	switch aud := c.Audience.(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audiences []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
+
+func (c *idTokenClaims) userInfo() *UserInfo {
+	// Some issuers send email_verified as the string "true"
+	verified := false
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &UserInfo{
+		Subject:       c.Subject,
+		Email:         strings.ToLower(c.Email),
+		EmailVerified: verified,
+		Name:          c.Name,
+		Picture:       c.Picture,
+	}
+}
+
+// VerifyIDToken checks the signature against the issuer's JWKS, then issuer,
+// audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(rawIDToken string, nonce string) (*idTokenClaims, error) {
+	metadata, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.get(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("id_token: %w", err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(metadata.Issuer, "/") {
+		return nil, errors.New("id_token was issued by another issuer")
+	}
+
+	audienceOK := false
+	for _, aud := range claims.audiences() {
+		if aud == p.Config.ClientID {
+			audienceOK = true
+		}
+	}
+	if !audienceOK {
+		return nil, errors.New("id_token was issued for another client")
+	}
+
+	if nonce == "" || !hmac.Equal([]byte(claims.Nonce), []byte(nonce)) {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	return claims, nil
+}
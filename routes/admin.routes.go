@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/controllers"
+	"github.com/vuongtruongson99/ocr_project/middleware"
+	"github.com/vuongtruongson99/ocr_project/models"
+)
+
+type AdminRouteController struct {
+	adminController controllers.AdminController
+}
+
+func NewRouteAdminController(adminController controllers.AdminController) AdminRouteController {
+	return AdminRouteController{adminController}
+}
+
+func (ac *AdminRouteController) AdminRoute(rg *gin.RouterGroup) {
+	router := rg.Group("admin")
+	router.Use(middleware.DeserializeUser(), middleware.DenyImpersonation(), middleware.RequireMFAEnrollment())
+
+	router.GET("/roles", middleware.RequirePermission(models.PermRolesRead), ac.adminController.FindRoles)
+	router.PATCH("/roles/:roleName", middleware.RequirePermission(models.PermRolesUpdate), ac.adminController.UpdateRole)
+	router.PUT("/users/:userId/role", middleware.RequirePermission(models.PermRolesAssign), ac.adminController.AssignRole)
+
+	canReadUsers := middleware.RequirePermission(models.PermUsersRead)
+	canManageUsers := middleware.RequirePermission(models.PermUsersManage)
+	router.GET("/console", canReadUsers, ac.adminController.ShowUsers)
+	router.GET("/console/users/:userId", canReadUsers, ac.adminController.ShowUser)
+	router.GET("/users", canReadUsers, ac.adminController.FindUsers)
+	router.GET("/users/:userId", canReadUsers, ac.adminController.FindUser)
+	router.GET("/users/:userId/posts", canReadUsers, ac.adminController.FindUserPosts)
+	router.GET("/users/:userId/generations", canReadUsers, ac.adminController.FindUserGenerations)
+	router.GET("/users/:userId/generations/:generationId/image", canReadUsers, ac.adminController.FindUserGenerationImage)
+	router.GET("/users/:userId/sessions", canReadUsers, ac.adminController.FindUserSessions)
+	router.POST("/users/:userId/suspend", canManageUsers, ac.adminController.SuspendUser)
+	router.DELETE("/users/:userId/suspend", canManageUsers, ac.adminController.UnsuspendUser)
+	router.POST("/users/:userId/password-reset", canManageUsers, ac.adminController.ForcePasswordReset)
+	router.POST("/users/:userId/impersonate", middleware.RequirePermission(models.PermUsersImpersonate), ac.adminController.ImpersonateUser)
+
+	router.GET("/lockouts", middleware.RequirePermission(models.PermLockoutsManage), ac.adminController.FindLockouts)
+	router.DELETE("/lockouts/:lockoutId", middleware.RequirePermission(models.PermLockoutsManage), ac.adminController.LiftLockout)
+}
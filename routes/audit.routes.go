@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vuongtruongson99/ocr_project/controllers"
+	"github.com/vuongtruongson99/ocr_project/middleware"
+	"github.com/vuongtruongson99/ocr_project/models"
+)
+
+type AuditRouteController struct {
+	auditController controllers.AuditController
+}
+
+func NewRouteAuditController(auditController controllers.AuditController) AuditRouteController {
+	return AuditRouteController{auditController}
+}
+
+func (ac *AuditRouteController) AuditRoute(rg *gin.RouterGroup) {
+	router := rg.Group("admin/audit")
+	router.Use(middleware.DeserializeUser(), middleware.DenyImpersonation(), middleware.RequireMFAEnrollment(), middleware.RequirePermission(models.PermAuditRead))
+
+	router.GET("", ac.auditController.FindEvents)
+	router.GET("/export", ac.auditController.ExportEvents)
+	router.GET("/verify", ac.auditController.VerifyChain)
+}
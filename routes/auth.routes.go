@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/vuongtruongson99/ocr_project/controllers"
 	"github.com/vuongtruongson99/ocr_project/middleware"
+	"github.com/vuongtruongson99/ocr_project/models"
 )
 
 type AuthRouteController struct {
@@ -20,12 +21,25 @@ func (rc *AuthRouteController) AuthRoute(rg *gin.RouterGroup) {
 	router.GET("/register", rc.authController.ShowSignUp)
 	router.POST("/register", rc.authController.SignUpUser)
 
+	router.GET("/verifyemail/:code", rc.authController.VerifyEmail)
+	router.POST("/verifyemail/resend", rc.authController.ResendVerificationEmail)
+	router.GET("/restore/:token", rc.authController.RestoreAccount)
+
 	router.GET("/login", rc.authController.ShowSignIn)
 	router.POST("/login", rc.authController.SignInUser)
+	router.POST("/login/mfa", rc.authController.SignInMFA)
+
+	router.GET("/forgotpassword", rc.authController.ShowForgotPassword)
+	router.POST("/forgotpassword", rc.authController.ForgotPassword)
+	router.GET("/resetpassword/:token", rc.authController.ShowResetPassword)
+	router.PATCH("/resetpassword/:token", rc.authController.ResetPassword)
 
 	router.GET("/refresh", rc.authController.RefreshAccessToken)
-	router.GET("/logout", middleware.DeserializeUser(), rc.authController.LogoutUser)
+	// No access token needed: logging out must work after it expired
+	router.POST("/logout", rc.authController.LogoutUser)
+	router.DELETE("/impersonation", middleware.DeserializeUser(), rc.authController.StopImpersonation)
 
-	router.GET("/text-to-image", middleware.DeserializeUser(), rc.authController.ShowMainTTI)
-	router.POST("/text-to-image", middleware.DeserializeUser(), rc.authController.RequestImage)
+	canGenerate := middleware.RequirePermission(models.PermGenerate)
+	router.GET("/text-to-image", middleware.DeserializeUser(), middleware.RequireMFAEnrollment(), canGenerate, rc.authController.ShowMainTTI)
+	router.POST("/text-to-image", middleware.DeserializeUserOrAPIKey(), middleware.DenyImpersonation(), middleware.RequireMFAEnrollment(), middleware.RequireScope(models.ScopeGenerate), canGenerate, rc.authController.RequestImage)
 }
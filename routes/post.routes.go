@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/vuongtruongson99/ocr_project/controllers"
 	"github.com/vuongtruongson99/ocr_project/middleware"
+	"github.com/vuongtruongson99/ocr_project/models"
 )
 
 type PostRouteController struct {
@@ -16,12 +17,25 @@ func NewRoutePostController(postController controllers.PostController) PostRoute
 
 func (pc *PostRouteController) PostRoute(rg *gin.RouterGroup) {
 	router := rg.Group("posts")
-	router.Use(middleware.DeserializeUser())
-	router.POST("/", pc.postController.CreatePost) // Create new post
-	router.GET("/", pc.postController.FindPosts)   // Get all posts
+	router.Use(middleware.DeserializeUserOrAPIKey(), middleware.DenyImpersonation(), middleware.RequireMFAEnrollment())
 
-	router.GET("/:postId", pc.postController.FindPostById)
-	router.PUT("/:postId", pc.postController.UpdatePost)
-	router.DELETE("/:postId", pc.postController.DeletePost)
+	canRead := middleware.RequireScope(models.ScopePostsRead)
+	canWrite := middleware.RequireScope(models.ScopePostsWrite)
+	router.POST("/", canWrite, middleware.RequirePermission(models.PermPostsCreate), pc.postController.CreatePost) // Create new post
+	router.GET("/", canRead, middleware.RequirePermission(models.PermPostsRead), pc.postController.FindPosts)      // Get all posts
+
+	router.GET("/:postId", canRead, middleware.RequirePermission(models.PermPostsRead), pc.postController.FindPostById)
+	router.PUT("/:postId", canWrite, pc.postController.UpdatePost)
+	router.DELETE("/:postId", canWrite, pc.postController.DeletePost)
+	router.PATCH("/:postId/status", canWrite, pc.postController.UpdatePostStatus)
+
+	router.GET("/:postId/revisions", canRead, middleware.RequirePermission(models.PermPostsRead), pc.postController.FindRevisions)
+	router.GET("/:postId/revisions/diff", canRead, middleware.RequirePermission(models.PermPostsRead), pc.postController.DiffRevisions)
+	router.GET("/:postId/revisions/:number", canRead, middleware.RequirePermission(models.PermPostsRead), pc.postController.FindRevision)
+	router.POST("/:postId/revisions/:number/rollback", canWrite, pc.postController.RollbackRevision)
+
+	router.GET("/trash", canRead, pc.postController.FindTrash)
+	router.POST("/trash/:postId/restore", canWrite, pc.postController.RestorePost)
+	router.DELETE("/trash/:postId", canWrite, pc.postController.PurgePost)
 
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/vuongtruongson99/ocr_project/controllers"
 	"github.com/vuongtruongson99/ocr_project/middleware"
+	"github.com/vuongtruongson99/ocr_project/models"
 )
 
 type UserRouteController struct {
@@ -17,5 +18,30 @@ func NewRouteUserController(userController controllers.UserController) UserRoute
 func (uc *UserRouteController) UserRoute(rg *gin.RouterGroup) {
 
 	router := rg.Group("users")
-	router.GET("/me", middleware.OauthDeserializeUser(), uc.userController.GetMe)
+	router.Use(middleware.DeserializeUser(), middleware.DenyImpersonation())
+	router.GET("/me", middleware.RequirePermission(models.PermProfileRead), uc.userController.GetMe)
+	router.PATCH("/me", uc.userController.UpdateMe)
+	router.DELETE("/me", uc.userController.DeleteMe)
+	router.GET("/me/export", middleware.DenyImpersonatedReads(), uc.userController.ExportMe)
+	router.GET("/me/generations/:generationId/image", uc.userController.FindMyGenerationImage)
+	router.GET("/me/settings", uc.userController.ShowSettings)
+	router.POST("/me/password", uc.userController.ChangePassword)
+	router.POST("/me/avatar", uc.userController.UploadAvatar)
+
+	router.GET("/me/sessions", middleware.DenyImpersonatedReads(), uc.userController.FindMySessions)
+	router.DELETE("/me/sessions", uc.userController.DeleteMySessions) // Log out everywhere
+	router.DELETE("/me/sessions/:sessionId", uc.userController.DeleteMySession)
+
+	router.GET("/me/identities", middleware.DenyImpersonatedReads(), uc.userController.FindMyIdentities)
+	router.POST("/me/identities/:provider", uc.userController.LinkIdentity)
+	router.DELETE("/me/identities/:identityId", uc.userController.UnlinkIdentity)
+
+	router.POST("/me/mfa/totp", uc.userController.EnrollTOTP)
+	router.POST("/me/mfa/totp/verify", uc.userController.VerifyTOTP)
+	router.DELETE("/me/mfa/totp", uc.userController.DisableTOTP)
+	router.POST("/me/mfa/recovery-codes", uc.userController.RegenerateRecoveryCodes)
+
+	router.GET("/me/api-keys", middleware.DenyImpersonatedReads(), uc.userController.FindMyAPIKeys)
+	router.POST("/me/api-keys", uc.userController.CreateAPIKey)
+	router.DELETE("/me/api-keys/:keyId", uc.userController.RevokeAPIKey)
 }
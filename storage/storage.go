@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+)
+
+// URLPrefix is where main.go serves the local store.
+const URLPrefix = "/uploads"
+
+// PublicDir is the only part of the store served without authentication.
+// Everything else, such as generated images, goes through a handler that
+// checks who may read it.
+const PublicDir = "avatars"
+
+const defaultDir = "uploads"
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Store keeps uploaded and generated files. Keys are slash separated relative
+// paths such as "avatars/<user id>.png".
+type Store interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	URL(key string) string
+	// Key returns the key of a URL made by URL, or false for any other URL.
+	Key(url string) (string, bool)
+}
+
+// LocalStore keeps files on the local disk under Dir (STORAGE_DIR).
+type LocalStore struct {
+	Dir string
+}
+
+// Default returns the configured store.
+func Default() Store {
+	return Local()
+}
+
+func Local() *LocalStore {
+	config, _ := initializers.LoadConfig(".")
+	if config.StorageDir == "" {
+		return &LocalStore{Dir: defaultDir}
+	}
+	return &LocalStore{Dir: config.StorageDir}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *LocalStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *LocalStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return URLPrefix + "/" + key
+}
+
+func (s *LocalStore) Key(url string) (string, bool) {
+	if !strings.HasPrefix(url, URLPrefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(url, URLPrefix+"/"), true
+}
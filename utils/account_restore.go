@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+// IssueAccountRestoreToken stores the hash of a fresh restore token on the
+// user and returns the token for the emailed link. It is valid as long as the
+// account is deleted but not purged.
+func IssueAccountRestoreToken(db *gorm.DB, user *models.User) (string, error) {
+	restoreToken := GenerateCode()
+	result := db.Unscoped().Model(user).Update("account_restore_token", HashCode(restoreToken))
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return restoreToken, nil
+}
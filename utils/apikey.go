@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks a credential as an API key rather than a JWT.
+const APIKeyPrefix = "vbdi_"
+
+var ErrInvalidAPIKey = errors.New("Invalid or expired API key")
+
+// GenerateAPIKey returns a new key "vbdi_<prefix>_<secret>" and its prefix.
+func GenerateAPIKey() (key string, prefix string) {
+	prefix = randstr.Hex(8)
+	return APIKeyPrefix + prefix + "_" + randstr.String(40), prefix
+}
+
+// IsAPIKey reports whether the credential looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// FindAPIKey looks the key up by its prefix and checks its hash, expiry and
+// revocation.
+func FindAPIKey(db *gorm.DB, key string) (*models.APIKey, error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if !IsAPIKey(key) || len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	result := db.First(&apiKey, "prefix = ? AND revoked_at IS NULL", parts[0])
+	if result.Error != nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashCode(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return &apiKey, nil
+}
+
+// TouchAPIKey records when and from where the key was last used.
+func TouchAPIKey(db *gorm.DB, apiKey *models.APIKey, ip string) {
+	db.Model(apiKey).Updates(map[string]interface{}{"last_used_at": time.Now(), "last_used_ip": ip})
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	AvatarSize      = 256
+	MaxAvatarBytes  = 5 << 20
+	maxAvatarPixels = 50_000_000 // refuses decompression bombs before decoding
+)
+
+var ErrUnsupportedAvatar = errors.New("Avatar must be a PNG, JPEG, GIF or WebP image")
+
+var avatarMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ProcessAvatar checks the upload is an image by its content, not its name or
+// headers, crops it to a centred square and scales it to AvatarSize. The result
+// is always a PNG, which also drops any metadata such as EXIF locations.
+func ProcessAvatar(data []byte) ([]byte, error) {
+	if !avatarMimeTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedAvatar
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxAvatarPixels {
+		return nil, ErrUnsupportedAvatar
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedAvatar
+	}
+
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, AvatarSize, AvatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, dst); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
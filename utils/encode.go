@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+)
+
+const defaultVerificationCodeTTL = 24 * time.Hour
+
+// VerificationCodeTTL is how long an email verification link stays valid.
+func VerificationCodeTTL() time.Duration {
+	config, _ := initializers.LoadConfig(".")
+	if config.VerificationCodeExpiresIn <= 0 {
+		return defaultVerificationCodeTTL
+	}
+	return config.VerificationCodeExpiresIn
+}
+
+// GenerateCode returns a random, URL-safe code suitable for emailed links.
+func GenerateCode() string {
+	return randstr.String(32)
+}
+
+// HashCode is used to store emailed codes so a database leak does not expose them.
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
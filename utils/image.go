@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"net/http"
+)
+
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageType sniffs the content type of an image and returns it with the file
+// extension to store it under.
+func ImageType(data []byte) (contentType string, extension string) {
+	contentType = http.DetectContentType(data)
+	if extension, ok := imageExtensions[contentType]; ok {
+		return contentType, extension
+	}
+	return contentType, ".bin"
+}
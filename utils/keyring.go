@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// Other instances pick up a rotation within keyringReloadInterval.
+	keyringReloadInterval = time.Minute
+	// minKeyringReload stops tokens with unknown kids from hammering the DB.
+	minKeyringReload = 5 * time.Second
+	signingKeyBits   = 2048
+)
+
+// Keyring holds the parsed RSA keys for one token use. Keys are stored in the
+// signing_keys table and managed with `go run keys/keys.go`. The key pair from
+// the config is always loaded too, so tokens signed before the keyring existed
+// (which carry no kid) stay valid; it signs only while the table has no
+// active key.
+type Keyring struct {
+	use string
+
+	mu        sync.Mutex
+	active    *keyPair
+	keys      map[string]*keyPair
+	legacyKid string
+	loadedAt  time.Time
+}
+
+type keyPair struct {
+	id      string
+	status  string
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+}
+
+var (
+	AccessKeys  = &Keyring{use: models.KeyUseAccess}
+	RefreshKeys = &Keyring{use: models.KeyUseRefresh}
+)
+
+// JSONWebKey is the public half of a signing key as published in the JWKS.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (k *Keyring) signingKey() (*keyPair, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Since(k.loadedAt) > keyringReloadInterval {
+		k.load()
+	}
+
+	if k.active == nil || k.active.private == nil {
+		return nil, fmt.Errorf("no active %s signing key", k.use)
+	}
+	return k.active, nil
+}
+
+func (k *Keyring) verificationKey(kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Since(k.loadedAt) > keyringReloadInterval {
+		k.load()
+	}
+
+	if kid == "" {
+		kid = k.legacyKid
+	}
+	if key, ok := k.keys[kid]; ok {
+		return key.public, nil
+	}
+
+	if time.Since(k.loadedAt) > minKeyringReload {
+		k.load()
+		if key, ok := k.keys[kid]; ok {
+			return key.public, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// PublicKeys returns every key a token may currently be signed with.
+func (k *Keyring) PublicKeys() []JSONWebKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Since(k.loadedAt) > keyringReloadInterval {
+		k.load()
+	}
+
+	jwks := make([]JSONWebKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwks = append(jwks, newJSONWebKey(key.id, key.public))
+	}
+	return jwks
+}
+
+// load replaces the cached keys. On a database error the config key pair is
+// still loaded, so a missing migration does not lock everyone out.
+func (k *Keyring) load() {
+	k.loadedAt = time.Now()
+	keys := map[string]*keyPair{}
+	var active *keyPair
+
+	config, _ := initializers.LoadConfig(".")
+	privateKey, publicKey := config.AccessTokenPrivateKey, config.AccessTokenPublicKey
+	if k.use == models.KeyUseRefresh {
+		privateKey, publicKey = config.RefreshTokenPrivateKey, config.RefreshTokenPublicKey
+	}
+
+	k.legacyKid = ""
+	if legacy, err := parseKeyPair(privateKey, publicKey); err == nil {
+		legacy.status = models.KeyRetired
+		keys[legacy.id] = legacy
+		k.legacyKid = legacy.id
+	} else if publicKey != "" {
+		log.Printf("? Could not load the %s key pair from the config: %v", k.use, err)
+	}
+
+	var rows []models.SigningKey
+	result := initializers.DB.Where("use = ?", k.use).Order("created_at").Find(&rows)
+	if result.Error != nil {
+		log.Printf("? Could not load %s signing keys: %v", k.use, result.Error)
+	}
+
+	for _, row := range rows {
+		key, err := parseKeyPair(row.PrivateKey, row.PublicKey)
+		if err != nil {
+			log.Printf("? Could not parse signing key %s: %v", row.ID, err)
+			continue
+		}
+		key.id = row.ID
+		key.status = row.Status
+		keys[key.id] = key
+
+		if row.Status == models.KeyActive {
+			active = key
+		}
+	}
+
+	if active == nil && k.legacyKid != "" {
+		active = keys[k.legacyKid]
+	}
+
+	k.keys = keys
+	k.active = active
+}
+
+// parseKeyPair decodes base64 PEM keys. The private key may be empty for a key
+// that is only used to verify.
+func parseKeyPair(privateKey string, publicKey string) (*keyPair, error) {
+	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode: %w", err)
+	}
+
+	public, err := jwt.ParseRSAPublicKeyFromPEM(decodedPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	key := &keyPair{id: KeyThumbprint(public), public: public}
+	if privateKey == "" {
+		return key, nil
+	}
+
+	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode key: %w", err)
+	}
+
+	key.private, err = jwt.ParseRSAPrivateKeyFromPEM(decodedPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	return key, nil
+}
+
+// KeyThumbprint is the RFC 7638 thumbprint of the key, used as its kid.
+func KeyThumbprint(key *rsa.PublicKey) string {
+	jwk := newJSONWebKey("", key)
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{jwk.E, jwk.Kty, jwk.N})
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newJSONWebKey(kid string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// GenerateSigningKey creates a new pending key pair for the use.
+func GenerateSigningKey(db *gorm.DB, use string) (*models.SigningKey, error) {
+	private, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.SigningKey{
+		ID:     KeyThumbprint(&private.PublicKey),
+		Use:    use,
+		Status: models.KeyPending,
+		PrivateKey: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(private),
+		})),
+		PublicKey: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: public,
+		})),
+		CreatedAt: time.Now(),
+	}
+
+	if err := db.Create(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateSigningKey activates the newest pending key, generating one if there
+// is none, and retires the active key. Retired keys keep validating the tokens
+// they signed, so nobody is logged out.
+func RotateSigningKey(db *gorm.DB, use string) (*models.SigningKey, error) {
+	var next models.SigningKey
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("use = ? AND status = ?", use, models.KeyPending).Order("created_at DESC").First(&next)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			key, err := GenerateSigningKey(tx, use)
+			if err != nil {
+				return err
+			}
+			next = *key
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.SigningKey{}).
+			Where("use = ? AND status = ?", use, models.KeyActive).
+			Updates(map[string]interface{}{"status": models.KeyRetired, "retired_at": now}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&next).Updates(map[string]interface{}{"status": models.KeyActive, "activated_at": now}).Error
+	})
+
+	return &next, err
+}
+
+// PruneSigningKeys deletes keys retired for longer than the lifetime of the
+// tokens they could have signed.
+func PruneSigningKeys(db *gorm.DB, use string, tokenTTL time.Duration) (int64, error) {
+	result := db.Where("use = ? AND status = ? AND retired_at < ?", use, models.KeyRetired, time.Now().Add(-tokenTTL)).
+		Delete(&models.SigningKey{})
+	return result.RowsAffected, result.Error
+}
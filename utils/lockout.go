@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Failures older than the window are forgotten.
+const (
+	loginFailureWindow = 15 * time.Minute
+	loginLockoutPeriod = 15 * time.Minute
+	maxLoginDelay      = time.Minute
+)
+
+// After delayAfter failures each new attempt has to wait twice as long as the
+// previous one; after lockAfter failures the key is locked out.
+type throttlePolicy struct {
+	delayAfter int
+	lockAfter  int
+}
+
+// A single IP can legitimately serve many users (NAT, offices), so it gets a
+// much larger budget than an account.
+var throttlePolicies = map[string]throttlePolicy{
+	models.ThrottleAccount: {delayAfter: 3, lockAfter: 10},
+	models.ThrottleIP:      {delayAfter: 20, lockAfter: 100},
+}
+
+func AccountThrottleKey(email string) string {
+	return models.ThrottleAccount + ":" + strings.ToLower(email)
+}
+
+func IPThrottleKey(ip string) string {
+	return models.ThrottleIP + ":" + ip
+}
+
+// LoginRetryAfter returns how long the caller has to wait before it may try
+// to sign in again, or zero when no key is locked or delayed.
+func LoginRetryAfter(db *gorm.DB, keys ...string) time.Duration {
+	var throttles []models.LoginThrottle
+	db.Where("key IN ? AND last_failure_at > ?", keys, time.Now().Add(-loginFailureWindow)).Find(&throttles)
+
+	var wait time.Duration
+	now := time.Now()
+	for _, throttle := range throttles {
+		var until time.Time
+		if throttle.LockedUntil != nil {
+			until = *throttle.LockedUntil
+		} else if policy := throttlePolicies[throttle.Kind]; throttle.Failures >= policy.delayAfter {
+			until = throttle.LastFailureAt.Add(loginDelay(throttle.Failures - policy.delayAfter))
+		}
+
+		if until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+
+	return wait
+}
+
+func loginDelay(step int) time.Duration {
+	if step > 6 {
+		return maxLoginDelay
+	}
+	return time.Duration(1<<step) * time.Second
+}
+
+// RecordLoginFailure counts a failed attempt against the key and reports
+// whether it has just locked the key out.
+func RecordLoginFailure(db *gorm.DB, key string, kind string, userID *uuid.UUID) (bool, error) {
+	locked := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		throttle := models.LoginThrottle{Key: key, Kind: kind}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&throttle).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&throttle, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if throttle.LastFailureAt.Before(now.Add(-loginFailureWindow)) {
+			throttle.Failures = 0
+			throttle.LockedUntil = nil
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		if userID != nil {
+			throttle.UserID = userID
+		}
+
+		if throttle.LockedUntil == nil && throttle.Failures >= throttlePolicies[kind].lockAfter {
+			lockedUntil := now.Add(loginLockoutPeriod)
+			throttle.LockedUntil = &lockedUntil
+			locked = true
+		}
+
+		return tx.Save(&throttle).Error
+	})
+
+	return locked, err
+}
+
+// ResetLoginFailures clears the key after a successful sign-in.
+func ResetLoginFailures(db *gorm.DB, key string) error {
+	return db.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
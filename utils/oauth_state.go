@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+)
+
+const (
+	// OauthFlowCookie keeps the PKCE verifier and nonce in the browser that started the flow.
+	OauthFlowCookie = "oauth_flow"
+	OauthFlowTTL    = 10 * time.Minute
+
+	defaultReturnPath = "/api/auth/text-to-image"
+)
+
+var ErrInvalidOauthState = errors.New("invalid or expired oauth state")
+
+// OauthState travels through the provider in the "state" query parameter.
+type OauthState struct {
+	ID        string `json:"id"`
+	Provider  string `json:"provider"`
+	ReturnTo  string `json:"return_to"`
+	ExpiresAt int64  `json:"exp"`
+	// LinkUserID is set when a signed-in user links a new identity.
+	LinkUserID string `json:"link_user_id,omitempty"`
+}
+
+// OauthFlow is stored in the OauthFlowCookie and never leaves this browser.
+type OauthFlow struct {
+	StateID      string `json:"state_id"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+}
+
+// NewOauthFlow creates the per-login secrets and the matching state.
+func NewOauthFlow(provider string, returnTo string) (*OauthFlow, *OauthState) {
+	flow := &OauthFlow{
+		StateID:      randstr.String(32),
+		CodeVerifier: randstr.String(64),
+		Nonce:        randstr.String(32),
+	}
+
+	state := &OauthState{
+		ID:        flow.StateID,
+		Provider:  provider,
+		ReturnTo:  SafeReturnPath(returnTo),
+		ExpiresAt: time.Now().Add(OauthFlowTTL).Unix(),
+	}
+
+	return flow, state
+}
+
+// CodeChallenge is the S256 PKCE challenge for the flow's verifier.
+func (f *OauthFlow) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(f.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SignOauthValue serialises v and appends an HMAC so it cannot be forged or altered.
+func SignOauthValue(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := oauthSignature(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return encoded + "." + signature, nil
+}
+
+// VerifyOauthValue checks the HMAC of a SignOauthValue result and decodes it into v.
+func VerifyOauthValue(signed string, v interface{}) error {
+	encoded, signature, found := strings.Cut(signed, ".")
+	if !found {
+		return ErrInvalidOauthState
+	}
+
+	expected, err := oauthSignature(encoded)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidOauthState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidOauthState
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidOauthState
+	}
+
+	return nil
+}
+
+// VerifyOauthCallback validates the returned state against the flow cookie
+// and the provider whose callback received it.
+func VerifyOauthCallback(provider string, signedState string, signedFlow string) (*OauthState, *OauthFlow, error) {
+	var state OauthState
+	if err := VerifyOauthValue(signedState, &state); err != nil {
+		return nil, nil, err
+	}
+
+	var flow OauthFlow
+	if err := VerifyOauthValue(signedFlow, &flow); err != nil {
+		return nil, nil, err
+	}
+
+	// The state must belong to the browser that started the login (CSRF)
+	if time.Now().Unix() > state.ExpiresAt || !hmac.Equal([]byte(state.ID), []byte(flow.StateID)) || state.Provider != provider {
+		return nil, nil, ErrInvalidOauthState
+	}
+
+	return &state, &flow, nil
+}
+
+// SafeReturnPath only lets through local paths on the allow-list, so the
+// callback cannot be turned into an open redirect.
+func SafeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\r\n") {
+		return defaultReturnPath
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	allowed := strings.Split(config.OauthAllowedReturnPaths, ",")
+	allowed = append(allowed, defaultReturnPath)
+
+	for _, prefix := range allowed {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")) {
+			return path
+		}
+	}
+
+	return defaultReturnPath
+}
+
+func oauthSignature(encoded string) (string, error) {
+	config, _ := initializers.LoadConfig(".")
+	if config.OauthStateSecret == "" {
+		return "", errors.New("OAUTH_STATE_SECRET is not configured")
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.OauthStateSecret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
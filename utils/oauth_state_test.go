@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/vuongtruongson99/ocr_project/oidc"
+	"github.com/vuongtruongson99/ocr_project/oidc/oidctest"
+)
+
+// TestMain gives LoadConfig an app.env with the OAuth settings, found before
+// any in the working directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "utils-test")
+	if err != nil {
+		panic(err)
+	}
+	env := "OAUTH_STATE_SECRET=test-secret\nOAUTH_ALLOWED_RETURN_PATHS=/posts, /api/users/me\n"
+	if err := os.WriteFile(filepath.Join(dir, "app.env"), []byte(env), 0600); err != nil {
+		panic(err)
+	}
+	viper.AddConfigPath(dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func mustSign(t *testing.T, v interface{}) string {
+	t.Helper()
+	signed, err := SignOauthValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// tamper flips the last character of the payload, keeping the signature.
+func tamper(signed string) string {
+	encoded, signature, _ := strings.Cut(signed, ".")
+	last := encoded[len(encoded)-1]
+	if last == 'A' {
+		last = 'B'
+	} else {
+		last = 'A'
+	}
+	return encoded[:len(encoded)-1] + string(last) + "." + signature
+}
+
+func TestVerifyOauthCallback(t *testing.T) {
+	flow, state := NewOauthFlow("google", "/posts")
+	otherFlow, _ := NewOauthFlow("google", "/posts")
+
+	expired := *state
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+
+	tests := []struct {
+		name     string
+		provider string
+		state    string
+		flow     string
+		wantErr  bool
+	}{
+		{"valid", "google", mustSign(t, state), mustSign(t, flow), false},
+		{"tampered state", "google", tamper(mustSign(t, state)), mustSign(t, flow), true},
+		{"tampered flow", "google", mustSign(t, state), tamper(mustSign(t, flow)), true},
+		{"unsigned state", "google", "eyJpZCI6IngifQ", mustSign(t, flow), true},
+		{"expired state", "google", mustSign(t, &expired), mustSign(t, flow), true},
+		{"provider mismatch", "github", mustSign(t, state), mustSign(t, flow), true},
+		{"flow from another browser", "google", mustSign(t, state), mustSign(t, otherFlow), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotState, gotFlow, err := VerifyOauthCallback(tt.provider, tt.state, tt.flow)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyOauthCallback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (gotState.ReturnTo != "/posts" || gotFlow.CodeVerifier != flow.CodeVerifier) {
+				t.Errorf("VerifyOauthCallback() = %+v, %+v", gotState, gotFlow)
+			}
+		})
+	}
+}
+
+func TestSafeReturnPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/posts", "/posts"},
+		{"/posts/42?tab=comments", "/posts/42?tab=comments"},
+		{"/api/users/me", "/api/users/me"},
+		{"/postsevil", defaultReturnPath},
+		{"/api/admin/users", defaultReturnPath},
+		{"", defaultReturnPath},
+		{"https://evil.example/posts", defaultReturnPath},
+		{"//evil.example/posts", defaultReturnPath},
+		{"/\\evil.example/posts", defaultReturnPath},
+		{"/posts\r\nSet-Cookie: x=y", defaultReturnPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := SafeReturnPath(tt.path); got != tt.want {
+				t.Errorf("SafeReturnPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// The example from RFC 7636, appendix B.
+func TestOauthFlowCodeChallenge(t *testing.T) {
+	flow := &OauthFlow{CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	if got, want := flow.CodeChallenge(), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge() = %q, want %q", got, want)
+	}
+}
+
+// authorize starts a login against the fake provider and returns the code
+// and state it redirects back with.
+func authorize(t *testing.T, provider *oidc.Provider, state string, flow *OauthFlow) (string, string) {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(state, flow.Nonce, flow.CodeChallenge())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %s to %q", res.Status, res.Header.Get("Location"))
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOauthFlowAgainstLocalProvider(t *testing.T) {
+	issuer := oidctest.NewIssuer("ocr-client")
+	defer issuer.Close()
+
+	provider := oidc.NewProvider(oidc.ProviderConfig{
+		Name:        "local",
+		ClientID:    "ocr-client",
+		RedirectURL: "http://localhost:8000/api/sessions/oauth/local/callback",
+		Scopes:      []string{"openid", "email"},
+		Issuer:      issuer.URL,
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		flow, state := NewOauthFlow("local", "https://evil.example/")
+		code, returnedState := authorize(t, provider, mustSign(t, state), flow)
+
+		gotState, gotFlow, err := VerifyOauthCallback("local", returnedState, mustSign(t, flow))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotState.ReturnTo != defaultReturnPath {
+			t.Errorf("ReturnTo = %q, want the default for an off-site return_to", gotState.ReturnTo)
+		}
+
+		token, err := provider.Exchange(code, gotFlow.CodeVerifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := provider.UserInfo(token, gotFlow.Nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Subject != issuer.Subject || info.Email != issuer.Email || !info.EmailVerified {
+			t.Errorf("UserInfo() = %+v", info)
+		}
+	})
+
+	t.Run("state for another provider", func(t *testing.T) {
+		flow, state := NewOauthFlow("github", "/posts")
+		_, returnedState := authorize(t, provider, mustSign(t, state), flow)
+
+		if _, _, err := VerifyOauthCallback("local", returnedState, mustSign(t, flow)); err == nil {
+			t.Error("VerifyOauthCallback() accepted a state issued for another provider")
+		}
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		flow, state := NewOauthFlow("local", "/posts")
+		code, _ := authorize(t, provider, mustSign(t, state), flow)
+
+		other, _ := NewOauthFlow("local", "/posts")
+		if _, err := provider.Exchange(code, other.CodeVerifier); err == nil {
+			t.Error("Exchange() accepted a code verifier that does not match the challenge")
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		flow, state := NewOauthFlow("local", "/posts")
+		code, _ := authorize(t, provider, mustSign(t, state), flow)
+
+		token, err := provider.Exchange(code, flow.CodeVerifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, _ := NewOauthFlow("local", "/posts")
+		if _, err := provider.UserInfo(token, other.Nonce); err == nil {
+			t.Error("UserInfo() accepted an id_token with another flow's nonce")
+		}
+	})
+}
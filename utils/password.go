@@ -1,21 +1,191 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Password hashing algorithms, selected with PASSWORD_HASHER. Stored hashes
+// name their algorithm and parameters, so any of them can be verified and
+// hashes made with older settings are upgraded on the next sign-in.
+const (
+	HasherArgon2id = "argon2id"
+	HasherBcrypt   = "bcrypt"
+)
+
+// Defaults for settings left empty in the config (RFC 9106 second recommendation).
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encodedHash string, password string) error
+	// Owns reports whether the stored hash was made by this algorithm.
+	Owns(encodedHash string) bool
+	// UpToDate reports whether the stored hash uses the current parameters.
+	UpToDate(encodedHash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hashedPassword), err
+}
+
+func (h BcryptHasher) Verify(encodedHash string, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password)); err != nil {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h BcryptHasher) Owns(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") || strings.HasPrefix(encodedHash, "$2b$") || strings.HasPrefix(encodedHash, "$2y$")
+}
+
+func (h BcryptHasher) UpToDate(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err == nil && cost >= h.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(encodedHash string, password string) error {
+	params, salt, key, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Owns(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+func (h Argon2idHasher) UpToDate(encodedHash string) bool {
+	params, _, _, err := decodeArgon2id(encodedHash)
+	return err == nil && params == h
+}
+
+func decodeArgon2id(encodedHash string) (params Argon2idHasher, salt []byte, key []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
+
+// passwordHashers returns the hasher for new passwords first, then the others
+// with the configured parameters.
+func passwordHashers() []PasswordHasher {
+	config, _ := initializers.LoadConfig(".")
+
+	bcryptHasher := BcryptHasher{Cost: config.BcryptCost}
+	if bcryptHasher.Cost == 0 {
+		bcryptHasher.Cost = bcrypt.DefaultCost
+	}
+
+	argon2idHasher := Argon2idHasher{
+		Memory:      config.Argon2Memory,
+		Iterations:  config.Argon2Iterations,
+		Parallelism: config.Argon2Parallelism,
+	}
+	if argon2idHasher.Memory == 0 {
+		argon2idHasher.Memory = defaultArgon2Memory
+	}
+	if argon2idHasher.Iterations == 0 {
+		argon2idHasher.Iterations = defaultArgon2Iterations
+	}
+	if argon2idHasher.Parallelism == 0 {
+		argon2idHasher.Parallelism = defaultArgon2Parallelism
+	}
+
+	if config.PasswordHasher == HasherBcrypt {
+		return []PasswordHasher{bcryptHasher, argon2idHasher}
+	}
+	return []PasswordHasher{argon2idHasher, bcryptHasher}
+}
+
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHashers()[0].Hash(password)
 
 	if err != nil {
 		return "", fmt.Errorf("Could not hash password %w", err)
 	}
 
-	return string(hashedPassword), err
+	return hashedPassword, err
 }
 
 func VerifyPassword(hashedPassword string, candidatePassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(candidatePassword))
+	for _, hasher := range passwordHashers() {
+		if hasher.Owns(hashedPassword) {
+			return hasher.Verify(hashedPassword, candidatePassword)
+		}
+	}
+	return ErrPasswordMismatch
+}
+
+// PasswordNeedsRehash reports whether the hash was made with another algorithm
+// or weaker parameters than the current ones.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	current := passwordHashers()[0]
+	return !current.Owns(hashedPassword) || !current.UpToDate(hashedPassword)
 }
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	_ "embed"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+)
+
+// Defaults for settings left empty in the config.
+const (
+	defaultPasswordMinLength        = 10
+	defaultPasswordMaxLength        = 128
+	defaultPasswordCharacterClasses = 3
+	breachedRangeLength             = 5
+	// bcrypt refuses to hash longer passwords.
+	bcryptMaxPasswordBytes = 72
+)
+
+// The SHA-1 hashes of common and breached passwords, built with
+// `go run breachlist/breachlist.go`.
+//
+//go:embed common-passwords.sha1.gz
+var breachedPasswordsGz []byte
+
+var (
+	breachedRangesOnce sync.Once
+	// breachedRanges maps the first five hex digits of a hash to the sorted
+	// remaining digits, like the Have I Been Pwned range API but offline.
+	breachedRanges map[string][]string
+)
+
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	CharacterClasses int // of lower case, upper case, digits and symbols
+	MaxBytes         int // of UTF-8, or 0 for no limit
+}
+
+// CurrentPasswordPolicy reads the policy from the config.
+func CurrentPasswordPolicy() PasswordPolicy {
+	config, _ := initializers.LoadConfig(".")
+
+	policy := PasswordPolicy{
+		MinLength:        config.PasswordMinLength,
+		MaxLength:        config.PasswordMaxLength,
+		CharacterClasses: config.PasswordCharacterClasses,
+	}
+	if policy.MinLength == 0 {
+		policy.MinLength = defaultPasswordMinLength
+	}
+	if policy.MaxLength == 0 {
+		policy.MaxLength = defaultPasswordMaxLength
+	}
+	if policy.CharacterClasses == 0 {
+		policy.CharacterClasses = defaultPasswordCharacterClasses
+	}
+	if config.PasswordHasher == HasherBcrypt {
+		policy.MaxBytes = bcryptMaxPasswordBytes
+		if policy.MaxLength > bcryptMaxPasswordBytes {
+			policy.MaxLength = bcryptMaxPasswordBytes
+		}
+	}
+
+	return policy
+}
+
+// Validate returns every rule the password breaks, reported on the "password"
+// field. Name and email are the account's, which the password must not contain.
+func (p PasswordPolicy) Validate(password string, name string, email string) []FieldError {
+	var errs []FieldError
+	violation := func(code string, message string) {
+		errs = append(errs, FieldError{Field: "password", Code: code, Message: message})
+	}
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		violation("min_length", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if length > p.MaxLength {
+		violation("max_length", fmt.Sprintf("Password must be at most %d characters long", p.MaxLength))
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violation("max_length", fmt.Sprintf("Password must be at most %d bytes long, accented letters and symbols count for more than one", p.MaxBytes))
+	}
+
+	if characterClasses(password) < p.CharacterClasses {
+		violation("character_classes", fmt.Sprintf("Password must mix at least %d of lower case letters, upper case letters, digits and symbols", p.CharacterClasses))
+	}
+
+	if containsPersonalInfo(password, name, email) {
+		violation("personal_info", "Password must not contain your name or email address")
+	}
+
+	if IsBreachedPassword(password) {
+		violation("breached", "This password is too common or has appeared in a data breach, please choose another one")
+	}
+
+	return errs
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo ignores parts shorter than three characters, which
+// would reject far too many passwords.
+func containsPersonalInfo(password string, name string, email string) bool {
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if local, _, found := strings.Cut(strings.ToLower(email), "@"); found {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBreachedPassword looks the password's SHA-1 up in the bundled list.
+func IsBreachedPassword(password string) bool {
+	breachedRangesOnce.Do(loadBreachedRanges)
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := breachedRanges[hash[:breachedRangeLength]]
+	i := sort.SearchStrings(suffixes, hash[breachedRangeLength:])
+	return i < len(suffixes) && suffixes[i] == hash[breachedRangeLength:]
+}
+
+func loadBreachedRanges() {
+	breachedRanges = map[string][]string{}
+
+	reader, err := gzip.NewReader(bytes.NewReader(breachedPasswordsGz))
+	if err != nil {
+		log.Println("? Could not read the breached password list:", err)
+		return
+	}
+
+	// The list is sorted, so every range comes out sorted too
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		hash := scanner.Text()
+		if len(hash) != 40 {
+			continue
+		}
+		prefix := hash[:breachedRangeLength]
+		breachedRanges[prefix] = append(breachedRanges[prefix], hash[breachedRangeLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("? Could not read the breached password list:", err)
+	}
+}
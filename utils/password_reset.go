@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+// PasswordResetTTL is how long a password reset link stays valid.
+func PasswordResetTTL() time.Duration {
+	config, _ := initializers.LoadConfig(".")
+	if config.PasswordResetExpiresIn <= 0 {
+		return defaultPasswordResetTTL
+	}
+	return config.PasswordResetExpiresIn
+}
+
+// IssuePasswordResetToken stores the hash of a fresh reset token on the user
+// and returns the token for the emailed link.
+func IssuePasswordResetToken(db *gorm.DB, user *models.User) (string, error) {
+	resetToken := GenerateCode()
+	result := db.Model(user).Updates(map[string]interface{}{
+		"password_reset_token": HashCode(resetToken),
+		"password_reset_at":    time.Now().Add(PasswordResetTTL()),
+	})
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return resetToken, nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+// IsPostOwner reports whether the user is the author of the post.
+func IsPostOwner(user models.User, post models.Post) bool {
+	return post.User == user.ID
+}
+
+// CanUpdatePost: the author needs posts:update:own, anyone else posts:update:any.
+func CanUpdatePost(db *gorm.DB, user models.User, post models.Post) bool {
+	if IsPostOwner(user, post) && HasPermission(db, user.Role, models.PermPostsUpdateOwn) {
+		return true
+	}
+	return HasPermission(db, user.Role, models.PermPostsUpdateAny)
+}
+
+// CanDeletePost: the author needs posts:delete:own, anyone else posts:delete:any.
+func CanDeletePost(db *gorm.DB, user models.User, post models.Post) bool {
+	if IsPostOwner(user, post) && HasPermission(db, user.Role, models.PermPostsDeleteOwn) {
+		return true
+	}
+	return HasPermission(db, user.Role, models.PermPostsDeleteAny)
+}
+
+// CanViewPost: published posts are public and drafts are only visible to
+// their author. Scheduled and archived posts are also visible to anyone with
+// posts:update:any, who may need to unpublish or reschedule them.
+func CanViewPost(db *gorm.DB, user models.User, post models.Post) bool {
+	if post.Status == models.PostPublished || IsPostOwner(user, post) {
+		return true
+	}
+	if post.Status == models.PostDraft {
+		return false
+	}
+	return HasPermission(db, user.Role, models.PermPostsUpdateAny)
+}
+
+// VisiblePosts narrows tx to the posts CanViewPost allows the user to see,
+// leaving out those of deleted accounts.
+func VisiblePosts(db *gorm.DB, tx *gorm.DB, user models.User) *gorm.DB {
+	tx = tx.Scopes(LiveAuthors)
+	if HasPermission(db, user.Role, models.PermPostsUpdateAny) {
+		return tx.Where(`status <> ? OR "user" = ?`, models.PostDraft, user.ID)
+	}
+	return tx.Where(`status = ? OR "user" = ?`, models.PostPublished, user.ID)
+}
+
+// LiveAuthors hides the posts of accounts in their deletion grace period,
+// which come back if the account is restored.
+func LiveAuthors(tx *gorm.DB) *gorm.DB {
+	return tx.Where(`NOT EXISTS (SELECT 1 FROM users WHERE users.id = posts."user" AND users.deleted_at IS NOT NULL)`)
+}
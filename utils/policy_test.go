@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"github.com/vuongtruongson99/ocr_project/utils/rbactest"
+)
+
+var (
+	author    = models.User{ID: uuid.New(), Role: models.RoleUser}
+	stranger  = models.User{ID: uuid.New(), Role: models.RoleUser}
+	moderator = models.User{ID: uuid.New(), Role: models.RoleModerator}
+	admin     = models.User{ID: uuid.New(), Role: models.RoleAdmin}
+)
+
+func postBy(user models.User, status string) models.Post {
+	return models.Post{ID: uuid.New(), User: user.ID, Status: status}
+}
+
+func TestCanUpdatePost(t *testing.T) {
+	db := rbactest.DB()
+
+	tests := []struct {
+		name string
+		user models.User
+		post models.Post
+		want bool
+	}{
+		{"owner", author, postBy(author, models.PostPublished), true},
+		{"other user", stranger, postBy(author, models.PostPublished), false},
+		{"moderator on another's post", moderator, postBy(author, models.PostPublished), false},
+		{"moderator on own post", moderator, postBy(moderator, models.PostPublished), true},
+		{"admin on another's post", admin, postBy(author, models.PostPublished), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanUpdatePost(db, tt.user, tt.post); got != tt.want {
+				t.Errorf("CanUpdatePost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanDeletePost(t *testing.T) {
+	db := rbactest.DB()
+
+	tests := []struct {
+		name string
+		user models.User
+		post models.Post
+		want bool
+	}{
+		{"owner", author, postBy(author, models.PostPublished), true},
+		{"other user", stranger, postBy(author, models.PostPublished), false},
+		{"moderator on another's post", moderator, postBy(author, models.PostPublished), true},
+		{"admin on another's post", admin, postBy(author, models.PostPublished), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanDeletePost(db, tt.user, tt.post); got != tt.want {
+				t.Errorf("CanDeletePost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanViewPost(t *testing.T) {
+	db := rbactest.DB()
+
+	tests := []struct {
+		name string
+		user models.User
+		post models.Post
+		want bool
+	}{
+		{"published to another user", stranger, postBy(author, models.PostPublished), true},
+		{"draft to its owner", author, postBy(author, models.PostDraft), true},
+		{"draft to another user", stranger, postBy(author, models.PostDraft), false},
+		{"draft to a moderator", moderator, postBy(author, models.PostDraft), false},
+		{"draft to an admin", admin, postBy(author, models.PostDraft), false},
+		{"scheduled to its owner", author, postBy(author, models.PostScheduled), true},
+		{"scheduled to another user", stranger, postBy(author, models.PostScheduled), false},
+		{"scheduled to a moderator", moderator, postBy(author, models.PostScheduled), false},
+		{"scheduled to an admin", admin, postBy(author, models.PostScheduled), true},
+		{"archived to another user", stranger, postBy(author, models.PostArchived), false},
+		{"archived to an admin", admin, postBy(author, models.PostArchived), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanViewPost(db, tt.user, tt.post); got != tt.want {
+				t.Errorf("CanViewPost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedRoles creates the default permissions and roles if they are missing and
+// grants each default role its default permissions. Existing grants are kept.
+func SeedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for name, description := range models.DefaultPermissions {
+			permission := models.Permission{Name: name, Description: description}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&permission).Error; err != nil {
+				return err
+			}
+		}
+
+		for name, permissionNames := range models.DefaultRoles {
+			role := models.Role{Name: name}
+			if err := tx.Where(models.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			var permissions []models.Permission
+			if err := tx.Where("name IN ?", permissionNames).Find(&permissions).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// HasPermission reports whether the named role grants the permission.
+func HasPermission(db *gorm.DB, role string, permission string) bool {
+	var count int64
+	db.Table("role_permissions").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("roles.name = ? AND permissions.name = ?", role, permission).
+		Count(&count)
+
+	return count > 0
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenUnknown = errors.New("refresh token is not recognised")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, all sessions of this sign-in have been revoked")
+)
+
+// IssueRefreshToken records a new refresh token in familyID and returns the signed JWT.
+func IssueRefreshToken(db *gorm.DB, userID uuid.UUID, familyID uuid.UUID) (string, error) {
+	config, _ := initializers.LoadConfig(".")
+
+	now := time.Now()
+	record := models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(config.RefreshTokenExpiresIn),
+		CreatedAt: now,
+	}
+
+	if err := db.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("could not store refresh token: %w", err)
+	}
+
+	return CreateToken(config.RefreshTokenExpiresIn, Claims{
+		StandardClaims: jwt.StandardClaims{Subject: userID.String(), Id: record.ID.String()},
+		Type:           TokenTypeRefresh,
+		SessionID:      familyID.String(),
+	}, RefreshKeys)
+}
+
+// RotateRefreshToken consumes a refresh JWT and issues its successor in the same
+// family. Presenting a token that was already rotated or revoked means it leaked,
+// so the whole family is revoked and ErrRefreshTokenReused returned along with
+// the revoked token's record.
+func RotateRefreshToken(db *gorm.DB, token string) (*models.RefreshToken, string, error) {
+	claims, err := ValidateToken(token, TokenTypeRefresh, RefreshKeys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var record models.RefreshToken
+	if result := db.First(&record, "id = ?", claims.Id); result.Error != nil {
+		return nil, "", ErrRefreshTokenUnknown
+	}
+
+	// The conditional update makes concurrent refreshes with one token race-safe:
+	// only one of them can mark it used.
+	now := time.Now()
+	result := db.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if err := RevokeRefreshTokenFamily(db, record.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return &record, "", ErrRefreshTokenReused
+	}
+
+	newToken, err := IssueRefreshToken(db, record.UserID, record.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &record, newToken, nil
+}
+
+// RevokeRefreshToken revokes the family of the given refresh JWT, used on logout.
+func RevokeRefreshToken(db *gorm.DB, token string) error {
+	claims, err := ValidateToken(token, TokenTypeRefresh, RefreshKeys)
+	if err != nil {
+		return err
+	}
+
+	var record models.RefreshToken
+	if result := db.First(&record, "id = ?", claims.Id); result.Error != nil {
+		return ErrRefreshTokenUnknown
+	}
+
+	return RevokeRefreshTokenFamily(db, record.FamilyID)
+}
+
+// RevokeRefreshTokenFamily ends the session the family belongs to.
+func RevokeRefreshTokenFamily(db *gorm.DB, familyID uuid.UUID) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeUserRefreshTokens signs the user out of every session.
+func RevokeUserRefreshTokens(db *gorm.DB, userID uuid.UUID) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeOtherSessions signs the user out of every session but the current one.
+func RevokeOtherSessions(db *gorm.DB, userID uuid.UUID, currentSessionID uuid.UUID) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+			Update("revoked_at", now).Error
+	})
+}
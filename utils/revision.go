@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordPostRevision snapshots the post as its next revision, written by
+// author. Posts from before revisions existed first get their current row
+// recorded as revision 1, credited to the post's owner, so history always
+// starts at the original. Call it in the transaction that writes the post.
+func RecordPostRevision(tx *gorm.DB, post models.Post, previous models.Post, author uuid.UUID, restoredFrom *int) (*models.PostRevision, error) {
+	// Serialises writers of the post, so two revisions cannot take one number
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Post{}, "id = ?", post.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var last int
+	if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+
+	if last == 0 && previous.ID != uuid.Nil {
+		base := models.PostRevision{
+			PostID:    previous.ID,
+			Number:    1,
+			AuthorID:  previous.User,
+			Title:     previous.Title,
+			Content:   previous.Content,
+			Image:     previous.Image,
+			CreatedAt: previous.UpdatedAt,
+		}
+		if err := tx.Create(&base).Error; err != nil {
+			return nil, err
+		}
+		last = 1
+	}
+
+	revision := models.PostRevision{
+		PostID:       post.ID,
+		Number:       last + 1,
+		AuthorID:     author,
+		Title:        post.Title,
+		Content:      post.Content,
+		Image:        post.Image,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// DiffPostRevisions lists the fields that differ from one revision to another.
+func DiffPostRevisions(from models.PostRevision, to models.PostRevision) []models.FieldChange {
+	changes := []models.FieldChange{}
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"title", from.Title, to.Title},
+		{"content", from.Content, to.Content},
+		{"image", from.Image, to.Image},
+	}
+	for _, field := range fields {
+		if field.from != field.to {
+			changes = append(changes, models.FieldChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+	return changes
+}
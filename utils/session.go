@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+var ErrAccountSuspended = errors.New("Your account has been suspended, please contact support")
+
+var ErrSessionRevoked = errors.New("This session has been signed out, please log in again")
+
+// StartSession records a new sign-in for the request's device and returns its
+// ID and the first refresh token of the session.
+func StartSession(db *gorm.DB, c *gin.Context, userID uuid.UUID, provider string) (uuid.UUID, string, error) {
+	var user models.User
+	if err := db.Select("suspended_at").First(&user, "id = ?", userID).Error; err != nil {
+		return uuid.Nil, "", fmt.Errorf("could not find user: %w", err)
+	}
+	if user.SuspendedAt != nil {
+		return uuid.Nil, "", ErrAccountSuspended
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Provider:   provider,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
+	if err := db.Create(&session).Error; err != nil {
+		return uuid.Nil, "", fmt.Errorf("could not store session: %w", err)
+	}
+
+	refreshToken, err := IssueRefreshToken(db, userID, session.ID)
+	return session.ID, refreshToken, err
+}
+
+// TouchSession updates when and from where the session was last used.
+func TouchSession(db *gorm.DB, c *gin.Context, sessionID uuid.UUID) error {
+	return db.Model(&models.Session{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"ip":           c.ClientIP(),
+		"user_agent":   c.Request.UserAgent(),
+	}).Error
+}
+
+// CheckSession returns ErrSessionRevoked unless the session exists, belongs
+// to the user and has not been revoked.
+func CheckSession(db *gorm.DB, userID uuid.UUID, sessionID string) error {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	var count int64
+	result := db.Model(&models.Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).Count(&count)
+	if result.Error != nil {
+		return result.Error
+	}
+	if count == 0 {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// CurrentSessionID returns the session of the request's refresh token cookie,
+// or uuid.Nil when there is none.
+func CurrentSessionID(db *gorm.DB, c *gin.Context) uuid.UUID {
+	cookie, err := c.Cookie("refresh_token")
+	if err != nil {
+		return uuid.Nil
+	}
+
+	claims, err := ValidateToken(cookie, TokenTypeRefresh, RefreshKeys)
+	if err != nil {
+		return uuid.Nil
+	}
+
+	var record models.RefreshToken
+	if result := db.First(&record, "id = ?", claims.Id); result.Error != nil {
+		return uuid.Nil
+	}
+
+	return record.FamilyID
+}
+
+// FindActiveSessions lists the user's sessions that are not revoked, most recent first.
+func FindActiveSessions(db *gorm.DB, userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	result := db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("last_used_at DESC").Find(&sessions)
+
+	return sessions, result.Error
+}
@@ -1,34 +1,64 @@
 package utils
 
 import (
-	"encoding/base64"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/vuongtruongson99/ocr_project/initializers"
+	"github.com/vuongtruongson99/ocr_project/models"
 )
 
-func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (string, error) {
-	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey) // Decode back to UTF8 string
-	if err != nil {
-		return "", fmt.Errorf("Could not decode key: %w", err)
-	}
+// Token types, stored in the "typ" claim. Every token is validated against the
+// type the caller expects, so a refresh or MFA token can never pass as an
+// access token even when the keys are shared.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFA is issued between the password and the second factor.
+	TokenTypeMFA = "mfa"
+	// TokenTypeEmail is reserved for signed links sent by email.
+	TokenTypeEmail = "email"
+
+	MFATokenTTL = 5 * time.Minute
+	// ImpersonationTTL bounds an admin's session as another user; it cannot
+	// be refreshed.
+	ImpersonationTTL = 30 * time.Minute
+)
 
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(decodedPrivateKey)
+// Claims are the claims of every token this app issues.
+type Claims struct {
+	jwt.StandardClaims
+	Type      string   `json:"typ"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	// Impersonator is the admin acting as the subject, if any.
+	Impersonator string `json:"imp,omitempty"`
+	// Provider is how an MFA token's first factor was proved, e.g. "local".
+	Provider string `json:"prv,omitempty"`
+}
 
+// CreateToken fills in the issuer, audience and time claims, then signs the
+// token with the keyring's active key and names it in "kid".
+func CreateToken(ttl time.Duration, claims Claims, keys *Keyring) (string, error) {
+	key, err := keys.signingKey()
 	if err != nil {
-		return "", fmt.Errorf("Create: parse key: %w", err)
+		return "", fmt.Errorf("Create: %w", err)
 	}
 
+	config, _ := initializers.LoadConfig(".")
 	now := time.Now().UTC()
 
-	claims := make(jwt.MapClaims)
-	claims["sub"] = payload
-	claims["exp"] = now.Add(ttl).Unix()
-	claims["iat"] = now.Unix()
-	claims["nbf"] = now.Unix()
+	claims.Issuer = tokenIssuer(&config)
+	claims.Audience = tokenAudience(&config)
+	claims.ExpiresAt = now.Add(ttl).Unix()
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unsigned.Header["kid"] = key.id
+	token, err := unsigned.SignedString(key.private)
 
 	if err != nil {
 		return "", fmt.Errorf("create: sign token: %w", err)
@@ -37,33 +67,81 @@ func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (str
 	return token, nil
 }
 
-func ValidateToken(token string, publicKey string) (interface{}, error) {
-	decodePublicKey, err := base64.StdEncoding.DecodeString(publicKey)
-	if err != nil {
-		return nil, fmt.Errorf("Could not decode: %w", err)
-	}
+// CreateAccessToken issues the access token of a session.
+func CreateAccessToken(user models.User, sessionID uuid.UUID) (string, error) {
+	config, _ := initializers.LoadConfig(".")
 
-	key, err := jwt.ParseRSAPublicKeyFromPEM(decodePublicKey)
+	return CreateToken(config.AccessTokenExpiresIn, Claims{
+		StandardClaims: jwt.StandardClaims{Subject: user.ID.String()},
+		Type:           TokenTypeAccess,
+		Roles:          []string{user.Role},
+		SessionID:      sessionID.String(),
+	}, AccessKeys)
+}
 
-	if err != nil {
-		return "", fmt.Errorf("validate: parse key: %w", err)
-	}
+// CreateImpersonationToken issues an access token for user on behalf of the
+// admin. It carries the admin's session, so it ends when that session is
+// signed out or when it expires, whichever comes first.
+func CreateImpersonationToken(user models.User, impersonatorID uuid.UUID, sessionID uuid.UUID) (string, error) {
+	return CreateToken(ImpersonationTTL, Claims{
+		StandardClaims: jwt.StandardClaims{Subject: user.ID.String()},
+		Type:           TokenTypeAccess,
+		Roles:          []string{user.Role},
+		SessionID:      sessionID.String(),
+		Impersonator:   impersonatorID.String(),
+	}, AccessKeys)
+}
+
+// ValidateToken checks the signature, the time claims (with JWT_LEEWAY of
+// clock skew), the issuer, the audience and that the token is of type typ.
+func ValidateToken(token string, typ string, keys *Keyring) (*Claims, error) {
+	// The time claims are checked below, with leeway
+	parser := jwt.Parser{SkipClaimsValidation: true}
 
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+	var claims Claims
+	_, err := parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
 		}
-		return key, nil
+		kid, _ := t.Header["kid"].(string)
+		return keys.verificationKey(kid)
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("Validate: %w", err)
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok || !parsedToken.Valid {
-		return nil, fmt.Errorf("Validate: invalid token")
+	config, _ := initializers.LoadConfig(".")
+	now := time.Now().Unix()
+	leeway := int64(config.JWTLeeway.Seconds())
+
+	switch {
+	case !claims.VerifyExpiresAt(now-leeway, true):
+		return nil, fmt.Errorf("Validate: token is expired")
+	case !claims.VerifyNotBefore(now+leeway, false), !claims.VerifyIssuedAt(now+leeway, false):
+		return nil, fmt.Errorf("Validate: token is not valid yet")
+	case !claims.VerifyIssuer(tokenIssuer(&config), true):
+		return nil, fmt.Errorf("Validate: unexpected issuer")
+	case !claims.VerifyAudience(tokenAudience(&config), true):
+		return nil, fmt.Errorf("Validate: unexpected audience")
+	case claims.Type != typ:
+		return nil, fmt.Errorf("Validate: expected a %s token", typ)
+	}
+
+	return &claims, nil
+}
+
+// The issuer defaults to the client origin, the audience to the issuer.
+func tokenIssuer(config *initializers.Config) string {
+	if config.JWTIssuer != "" {
+		return config.JWTIssuer
 	}
+	return config.ClientOrigin
+}
 
-	return claims["sub"], nil
+func tokenAudience(config *initializers.Config) string {
+	if config.JWTAudience != "" {
+		return config.JWTAudience
+	}
+	return tokenIssuer(config)
 }
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"image/png"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/thanhpk/randstr"
+	"github.com/vuongtruongson99/ocr_project/models"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "VBDI"
+	totpPeriod        = 30
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+// GenerateTOTPKey creates a new secret for the account and renders its QR code.
+func GenerateTOTPKey(accountName string) (*otp.Key, string, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var qrCode bytes.Buffer
+	if err := png.Encode(&qrCode, img); err != nil {
+		return nil, "", err
+	}
+
+	return key, base64.StdEncoding.EncodeToString(qrCode.Bytes()), nil
+}
+
+// ValidateTOTP accepts the current code and one step either side for clock
+// drift. Each code is accepted once: its step must be later than the last
+// step accepted for the user, which it then becomes.
+func ValidateTOTP(db *gorm.DB, user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+
+	now := time.Now().UTC()
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, t, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil || subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		step := t.Unix() / totpPeriod
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			UpdateColumn("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return false
+		}
+
+		user.TOTPLastStep = step
+		return true
+	}
+	return false
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and returns new ones.
+// Only their hashes are stored, so they can be shown once.
+func ReplaceRecoveryCodes(db *gorm.DB, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := 0; i < recoveryCodeCount; i++ {
+			code := randstr.Hex(5) + "-" + randstr.Hex(5)
+			codes = append(codes, code)
+
+			record := models.RecoveryCode{UserID: userID, CodeHash: HashCode(code), CreatedAt: now}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return codes, err
+}
+
+// VerifySecondFactor accepts a TOTP code or an unused recovery code, which is
+// then burnt.
+func VerifySecondFactor(db *gorm.DB, user *models.User, code string) bool {
+	if ValidateTOTP(db, user, code) {
+		return true
+	}
+
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, HashCode(code)).
+		Update("used_at", time.Now())
+
+	return result.Error == nil && result.RowsAffected == 1
+}
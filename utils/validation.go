@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is one validation error on one form field, so forms can show it
+// next to the field and API clients can match on Code.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors turns a binding error into field errors. Field names are the
+// struct field names with a lower case first letter, which matches our forms.
+func FieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+
+	errs := make([]FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		field := []rune(fieldError.Field())
+		field[0] = unicode.ToLower(field[0])
+
+		errs = append(errs, FieldError{
+			Field:   string(field),
+			Code:    fieldError.Tag(),
+			Message: validationMessage(fieldError),
+		})
+	}
+	return errs
+}
+
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "This field is required"
+	case "email":
+		return "Must be a valid email address"
+	case "min":
+		return fmt.Sprintf("Must be at least %s characters long", fieldError.Param())
+	case "max":
+		return fmt.Sprintf("Must be at most %s characters long", fieldError.Param())
+	default:
+		return "This value is invalid"
+	}
+}
+
+// FieldErrorsByName groups messages by field for the HTML templates.
+func FieldErrorsByName(errs []FieldError) map[string][]string {
+	byName := map[string][]string{}
+	for _, err := range errs {
+		byName[err.Field] = append(byName[err.Field], err.Message)
+	}
+	return byName
+}